@@ -1,11 +1,21 @@
 package configs
 
 import (
+	"errors"
 	"fmt"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"ibTgBot/internal/app/redact"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 )
 
+// Префикс переменных окружения, например IBTGBOT_TG_TOKEN
+const envPrefix = "IBTGBOT"
+
 type ConfIn interface {
 	GetDB() DbConfig
 	GetTG() TgConfig
@@ -28,8 +38,19 @@ func (c *Conf) GetTG() TgConfig {
 }
 
 type Conf struct {
-	DB DbConfig
-	TG TgConfig
+	DB      DbConfig      `mapstructure:"db"`
+	TG      TgConfig      `mapstructure:"tg"`
+	Log     LogConfig     `mapstructure:"log"`
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	Health  HealthConfig  `mapstructure:"health"`
+	Tracing TracingConfig `mapstructure:"tracing"`
+	API     APIConfig     `mapstructure:"api"`
+	// Флаги функциональности, задаются только в файле и меняются без перезапуска
+	Features map[string]bool `mapstructure:"features"`
+	// Тексты сообщений по языкам, заменяют сообщения каталога с тем же ключом
+	Messages map[string]map[string]interface{} `mapstructure:"messages"`
+
+	path string // Путь к файлу конфигурации для отслеживания изменений
 }
 
 type DbConfig struct {
@@ -37,70 +58,442 @@ type DbConfig struct {
 	Host     string `mapstructure:"host"`
 	User     string `mapstructure:"user"`
 	Password string `mapstructure:"password"`
+	// Путь к файлу с паролем (секреты Docker/Kubernetes)
+	PasswordFile string `mapstructure:"password_file"`
 }
 
 type TgConfig struct {
-	Token   string `mapstructure:"token"`
-	RuCanal int64  `mapstructure:"ruCanal"`
-	EsCanal int64  `mapstructure:"esCanal"`
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"token_file"` // Путь к файлу с токеном
+	RuCanal   int64  `mapstructure:"ruCanal"`
+	EsCanal   int64  `mapstructure:"esCanal"`
+	// Режим получения обновлений: polling (по умолчанию) или webhook
+	Mode              string `mapstructure:"mode"`
+	WebhookListen     string `mapstructure:"webhookListen"` // Адрес, на котором слушает бот, например :8443
+	WebhookURL        string `mapstructure:"webhookUrl"`    // Публичный URL балансировщика
+	WebhookSecret     string `mapstructure:"webhookSecret"` // Проверяется в заголовке X-Telegram-Bot-Api-Secret-Token
+	WebhookSecretFile string `mapstructure:"webhookSecret_file"`
+	WebhookCert       string `mapstructure:"webhookCert"` // Необязательные сертификат и ключ для TLS
+	WebhookKey        string `mapstructure:"webhookKey"`
+	// Снимать вебхук при остановке. Включается только для единственной реплики,
+	// иначе остановка одной реплики отключает вебхук для всех остальных
+	WebhookRemove bool `mapstructure:"webhookRemove"`
+	// Адрес собственного сервера telegram-bot-api, по умолчанию https://api.telegram.org
+	ApiURL string `mapstructure:"apiUrl"`
+	// Исходящий прокси: http://, https:// или socks5://
+	Proxy string `mapstructure:"proxy"`
+	// Таймауты HTTP клиента в секундах
+	Timeout     int `mapstructure:"timeout"`
+	DialTimeout int `mapstructure:"dialTimeout"`
+	// Telegram ID администраторов, меняются без перезапуска
+	Admins []int64 `mapstructure:"admins"`
+	// Лимит сообщений в секунду для рассылок, меняется без перезапуска
+	RateLimit int `mapstructure:"rateLimit"`
+	// Чат для отчетов об ошибках, 0 - отчеты не отправляются, меняется без перезапуска
+	ErrorChat int64 `mapstructure:"errorChat"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug, info, warn, error
+	Format string `mapstructure:"format"` // text или json
+	Stdout bool   `mapstructure:"stdout"` // Дублировать лог в stdout
+	// Файл логов и параметры ротации, пустой путь отключает запись в файл
+	File       string `mapstructure:"file"`
+	MaxSize    int    `mapstructure:"maxSize"`    // Мегабайт
+	MaxBackups int    `mapstructure:"maxBackups"` // Количество старых файлов
+	MaxAge     int    `mapstructure:"maxAge"`     // Дней хранения старых файлов
+	Compress   bool   `mapstructure:"compress"`
+}
+
+type MetricsConfig struct {
+	Listen string `mapstructure:"listen"` // Адрес HTTP сервера /metrics, пустой отключает сервер
+}
+
+type HealthConfig struct {
+	Listen string `mapstructure:"listen"` // Адрес HTTP сервера /healthz и /readyz, пустой отключает сервер
+}
+
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"`    // none, stdout или otlp
+	Endpoint    string  `mapstructure:"endpoint"`    // Адрес OTLP/HTTP коллектора, например http://localhost:4318
+	Insecure    bool    `mapstructure:"insecure"`    // Без TLS до коллектора
+	SampleRatio float64 `mapstructure:"sampleRatio"` // Доля записываемых трасс от 0 до 1
 }
 
+type APIConfig struct {
+	Listen    string `mapstructure:"listen"` // Адрес REST API администрирования, пустой отключает API
+	Token     string `mapstructure:"token"`  // Bearer токен для доступа к API
+	TokenFile string `mapstructure:"token_file"`
+}
+
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// IsWebhook сообщает, настроен ли бот на получение обновлений через вебхук
+func (t TgConfig) IsWebhook() bool {
+	return t.Mode == ModeWebhook
+}
+
+// setDefaults задает значения по умолчанию, самый нижний уровень конфигурации
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("tg.mode", ModePolling)
+	v.SetDefault("tg.timeout", 60)
+	v.SetDefault("tg.dialTimeout", 10)
+	v.SetDefault("tg.rateLimit", 25)
+
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "text")
+	v.SetDefault("log.stdout", true)
+	v.SetDefault("log.file", "/var/log/info-bot/ibTgBot/ibTgBot.log")
+	v.SetDefault("log.maxSize", 10)
+	v.SetDefault("log.maxBackups", 5)
+	v.SetDefault("log.maxAge", 28)
+	v.SetDefault("log.compress", true)
+
+	v.SetDefault("metrics.listen", ":9090")
+	v.SetDefault("health.listen", ":8080")
+
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.sampleRatio", 1.0)
+}
+
+// New собирает конфигурацию по уровням: значения по умолчанию, файл,
+// переменные окружения IBTGBOT_*, флаги командной строки вида --tg.token
 func New(confPatch string) (*Conf, error) {
-	// Получаем текущую рабочую директорию
-	wd, erra := os.Getwd()
-	if erra != nil {
-		return nil, fmt.Errorf("ошибка получени текущего каталога: %v\n", erra)
+	keys := configKeys(reflect.TypeOf(Conf{}), "")
+
+	flags, err := parseFlags(keys, os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if path, _ := flags.GetString("config"); path != "" {
+		confPatch = path
+	}
+
+	configPath, err := resolvePath(confPatch)
+	if err != nil {
+		return nil, err
 	}
 
-	// Формируем путь к файлу конфигурации
-	configPath := wd + confPatch
+	return load(configPath, keys, flags)
+}
+
+// load читает и проверяет конфигурацию, используется при старте и при перечитывании файла
+func load(configPath string, keys []string, flags *pflag.FlagSet) (*Conf, error) {
+	v := viper.New()
+	setDefaults(v)
 
-	// Проверяем, существует ли файл по указанному пути
+	if err := readFile(v, configPath); err != nil {
+		return nil, err
+	}
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range keys {
+		if err := v.BindEnv(key); err != nil {
+			return nil, fmt.Errorf("ошибка привязки переменной окружения %s: %w", key, err)
+		}
+		if err := v.BindPFlag(key, flags.Lookup(key)); err != nil {
+			return nil, fmt.Errorf("ошибка привязки флага %s: %w", key, err)
+		}
+	}
+
+	conf := Conf{path: configPath}
+	if err := v.Unmarshal(&conf); err != nil {
+		return nil, fmt.Errorf("невозможно прочитать структуру конфигурации: %w", err)
+	}
+
+	if err := conf.readSecrets(); err != nil {
+		return nil, err
+	}
+	// Секреты маскируются во всех логах, включая ошибки сторонних библиотек
+	redact.Add(conf.DB.Password, conf.TG.Token, conf.TG.WebhookSecret, proxyPassword(conf.TG.Proxy), conf.API.Token)
+
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("некорректная конфигурация:\n%w", err)
+	}
+
+	return &conf, nil
+}
+
+// readSecrets читает секреты из файлов, указанных в параметрах *_file.
+// Значение из файла имеет приоритет над значением параметра
+func (c *Conf) readSecrets() error {
+	secrets := []struct {
+		key   string
+		path  string
+		value *string
+	}{
+		{"db.password_file", c.DB.PasswordFile, &c.DB.Password},
+		{"tg.token_file", c.TG.TokenFile, &c.TG.Token},
+		{"tg.webhookSecret_file", c.TG.WebhookSecretFile, &c.TG.WebhookSecret},
+		{"api.token_file", c.API.TokenFile, &c.API.Token},
+	}
+
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("%s: ошибка чтения файла секрета: %w", secret.key, err)
+		}
+		*secret.value = strings.TrimSpace(string(data))
+	}
+
+	return nil
+}
+
+// proxyPassword возвращает пароль из адреса прокси, если он указан
+func proxyPassword(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return password
+}
+
+// Псевдонимы без методов, чтобы String() не вызывал себя рекурсивно
+type (
+	dbConfig  DbConfig
+	tgConfig  TgConfig
+	apiConfig APIConfig
+)
+
+func (c *Conf) String() string {
+	return fmt.Sprintf("{DB:%s TG:%s Log:%+v Metrics:%+v Health:%+v Tracing:%+v API:%s}",
+		c.DB, c.TG, c.Log, c.Metrics, c.Health, c.Tracing, c.API)
+}
+
+// String выводит конфигурацию БД без пароля
+func (d DbConfig) String() string {
+	d.Password = redact.Value(d.Password)
+	return fmt.Sprintf("%+v", dbConfig(d))
+}
+
+// String выводит конфигурацию ТГ без токена, секрета вебхука и пароля прокси
+func (t TgConfig) String() string {
+	t.Token = redact.Value(t.Token)
+	t.WebhookSecret = redact.Value(t.WebhookSecret)
+	if u, err := url.Parse(t.Proxy); err == nil && u.User != nil {
+		t.Proxy = u.Redacted()
+	}
+	return fmt.Sprintf("%+v", tgConfig(t))
+}
+
+// String выводит конфигурацию API без токена
+func (a APIConfig) String() string {
+	a.Token = redact.Value(a.Token)
+	return fmt.Sprintf("%+v", apiConfig(a))
+}
+
+// resolvePath возвращает абсолютный путь к файлу конфигурации,
+// относительные пути считаются от текущей рабочей директории
+func resolvePath(confPatch string) (string, error) {
+	if filepath.IsAbs(confPatch) {
+		return confPatch, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения текущего каталога: %w", err)
+	}
+
+	return filepath.Join(wd, confPatch), nil
+}
+
+// readFile читает HCL файл, если он существует. Блоки HCL приходят
+// массивами карт, поэтому каждый блок сворачивается в одну карту
+func readFile(v *viper.Viper, configPath string) error {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("Файл конфигурации не существует: %s\n", configPath)
+		// Файл необязателен, параметры могут прийти из окружения и флагов
+		return nil
+	}
+
+	file := viper.New()
+	file.SetConfigFile(configPath)
+	file.SetConfigType("hcl") // Указываем формат файла конфигурации
+
+	if err := file.ReadInConfig(); err != nil {
+		return fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+	}
+
+	settings := make(map[string]interface{})
+	for key, value := range file.AllSettings() {
+		settings[key] = collapse(value)
+	}
+
+	if err := v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("ошибка разбора файла конфигурации: %w", err)
+	}
+
+	return nil
+}
+
+// collapse сворачивает блоки HCL, в том числе вложенные (messages { ru { ... } }), в карты
+func collapse(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		section := make(map[string]interface{})
+		for _, block := range v {
+			for k, val := range block {
+				section[k] = collapse(val)
+			}
+		}
+		return section
+	case map[string]interface{}:
+		section := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			section[k] = collapse(val)
+		}
+		return section
+	default:
+		return value
+	}
+}
+
+// parseFlags разбирает флаги командной строки. Для каждого параметра
+// конфигурации доступен флаг с тем же именем, например --db.host
+func parseFlags(keys []string, args []string) (*pflag.FlagSet, error) {
+	flags := pflag.NewFlagSet("ibTgBot", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.String("config", "", "путь к файлу конфигурации")
+	for _, key := range keys {
+		flags.String(key, "", "")
 	}
 
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("hcl") // Указываем формат файла конфигурации
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("ошибка разбора флагов: %w", err)
+	}
+
+	return flags, nil
+}
+
+// configKeys возвращает ключи всех параметров конфигурации по тегам mapstructure.
+// Карты (features, messages) задаются только в файле и в список не входят
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" || field.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(field.Type, key)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// envName возвращает имя переменной окружения для ключа конфигурации
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу
+func (c *Conf) Validate() error {
+	var errs []error
+
+	required := func(key, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s: обязательный параметр не задан (%s)", key, envName(key)))
+		}
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+	required("db.name", c.DB.Name)
+	required("db.host", c.DB.Host)
+	required("db.user", c.DB.User)
+	if c.TG.Token == "" {
+		errs = append(errs, fmt.Errorf("tg.token: обязательный параметр не задан (%s или %s)",
+			envName("tg.token"), envName("tg.token_file")))
 	}
 
-	// Извлекаем массив карт для БД
-	var configs []map[string]interface{}
-	if err := viper.UnmarshalKey("db", &configs); err != nil {
-		return nil, fmt.Errorf("невозможно прочитать структуру файла конфигурации БД: %w", err)
+	if c.TG.RuCanal == 0 {
+		errs = append(errs, fmt.Errorf("tg.ruCanal: не задан ID канала (%s)", envName("tg.ruCanal")))
+	}
+	if c.TG.EsCanal == 0 {
+		errs = append(errs, fmt.Errorf("tg.esCanal: не задан ID канала (%s)", envName("tg.esCanal")))
 	}
 
-	var (
-		dbConf DbConfig
-		tgConf TgConfig
-	)
-	// Предполагаем, что первая карта в массиве содержит наши настройки
-	if len(configs) > 0 {
-		dbConf.Name = configs[0]["name"].(string)
-		dbConf.Host = configs[0]["host"].(string)
-		dbConf.User = configs[0]["user"].(string)
-		dbConf.Password = configs[0]["password"].(string)
-	} else {
-		return nil, fmt.Errorf("не найдены параметры конфигурации базы данных")
+	switch c.TG.Mode {
+	case ModePolling:
+	case ModeWebhook:
+		required("tg.webhookListen", c.TG.WebhookListen)
+		required("tg.webhookUrl", c.TG.WebhookURL)
+		if (c.TG.WebhookCert == "") != (c.TG.WebhookKey == "") {
+			errs = append(errs, fmt.Errorf("tg.webhookCert, tg.webhookKey: для TLS необходимо указать оба параметра"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tg.mode: неизвестный режим %q, допустимо %s или %s", c.TG.Mode, ModePolling, ModeWebhook))
 	}
 
-	// Извлекаем массив карт для ТГ
-	var tgConfigs []map[string]interface{}
-	if err := viper.UnmarshalKey("tg", &tgConfigs); err != nil {
-		return nil, fmt.Errorf("невозможно прочитать структуру файла конфигурации ТГ: %w", err)
+	if c.TG.WebhookURL != "" {
+		if u, err := url.Parse(c.TG.WebhookURL); err != nil || u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("tg.webhookUrl: ожидается https адрес, получено %q", c.TG.WebhookURL))
+		}
+	}
+	if c.TG.ApiURL != "" {
+		if u, err := url.Parse(c.TG.ApiURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tg.apiUrl: некорректный адрес %q", c.TG.ApiURL))
+		}
+	}
+	if c.TG.Proxy != "" {
+		if u, err := url.Parse(c.TG.Proxy); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tg.proxy: некорректный адрес прокси"))
+		}
+	}
+
+	// Таймаут клиента должен превышать таймаут long polling
+	if c.TG.Timeout <= 10 {
+		errs = append(errs, fmt.Errorf("tg.timeout: должен быть больше 10 секунд, получено %d", c.TG.Timeout))
+	}
+	if c.TG.RateLimit <= 0 || c.TG.RateLimit > 30 {
+		errs = append(errs, fmt.Errorf("tg.rateLimit: ожидается от 1 до 30 сообщений в секунду, получено %d", c.TG.RateLimit))
+	}
+	if c.TG.DialTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("tg.dialTimeout: должен быть больше 0, получено %d", c.TG.DialTimeout))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: неизвестный уровень %q, допустимо debug, info, warn, error", c.Log.Level))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log.format: неизвестный формат %q, допустимо text или json", c.Log.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing.endpoint: для экспорта otlp ожидается адрес коллектора, получено %q", c.Tracing.Endpoint))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: неизвестный экспорт %q, допустимо none, stdout или otlp", c.Tracing.Exporter))
+	}
+	if c.API.Listen != "" && len(c.API.Token) < 16 {
+		errs = append(errs, fmt.Errorf("api.token: для включенного API нужен токен не короче 16 символов (%s или %s)",
+			envName("api.token"), envName("api.token_file")))
 	}
 
-	// Предполагаем, что первая карта в массиве содержит наши настройки
-	if len(tgConfigs) > 0 {
-		tgConf.Token = tgConfigs[0]["token"].(string)
-		tgConf.RuCanal = int64(tgConfigs[0]["ruCanal"].(int))
-		tgConf.EsCanal = int64(tgConfigs[0]["esCanal"].(int))
-	} else {
-		return nil, fmt.Errorf("не найдены параметры конфигурации ТГ")
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sampleRatio: должно быть от 0 до 1, получено %v", c.Tracing.SampleRatio))
 	}
 
-	return &Conf{DB: dbConf, TG: tgConf}, nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,153 @@
+package configs
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func validConf() Conf {
+	var c Conf
+	c.DB.Name, c.DB.Host, c.DB.User = "infobot", "localhost", "bot"
+	c.TG.Token = "123456:token"
+	c.TG.RuCanal, c.TG.EsCanal = -1001, -1002
+	c.TG.Mode = ModePolling
+	c.TG.Timeout, c.TG.DialTimeout, c.TG.RateLimit = 60, 10, 25
+	c.Log.Level, c.Log.Format = "info", "text"
+	c.Tracing.Exporter = "none"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(c *Conf)
+		want   []string // Ключи, которые должны быть в ошибке
+	}{
+		{name: "valid", change: func(c *Conf) {}},
+		{name: "required", change: func(c *Conf) { c.DB.Host, c.TG.Token = "", "" }, want: []string{"db.host", "tg.token"}},
+		{name: "channels", change: func(c *Conf) { c.TG.RuCanal, c.TG.EsCanal = 0, 0 }, want: []string{"tg.ruCanal", "tg.esCanal"}},
+		{name: "mode", change: func(c *Conf) { c.TG.Mode = "push" }, want: []string{"tg.mode"}},
+		{name: "webhook", change: func(c *Conf) {
+			c.TG.Mode, c.TG.WebhookURL, c.TG.WebhookCert = ModeWebhook, "http://bot.example.com", "cert.pem"
+		}, want: []string{"tg.webhookListen", "tg.webhookUrl", "tg.webhookCert"}},
+		{name: "timeout", change: func(c *Conf) { c.TG.Timeout = 10 }, want: []string{"tg.timeout"}},
+		{name: "rate limit", change: func(c *Conf) { c.TG.RateLimit = 31 }, want: []string{"tg.rateLimit"}},
+		{name: "log", change: func(c *Conf) { c.Log.Level, c.Log.Format = "trace", "xml" }, want: []string{"log.level", "log.format"}},
+		{name: "tracing", change: func(c *Conf) { c.Tracing.Exporter = "otlp" }, want: []string{"tracing.endpoint"}},
+		{name: "api token", change: func(c *Conf) { c.API.Listen, c.API.Token = ":8090", "short" }, want: []string{"api.token"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validConf()
+			tc.change(&c)
+
+			err := c.Validate()
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors for %v", tc.want)
+			}
+			// Все ошибки возвращаются одним списком, по строке на параметр
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tc.want) {
+				t.Errorf("Validate() returned %d errors, want %d:\n%v", len(lines), len(tc.want), err)
+			}
+			for _, key := range tc.want {
+				if !strings.Contains(err.Error(), key+":") && !strings.Contains(err.Error(), key+",") {
+					t.Errorf("Validate() error does not mention %s:\n%v", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadDiff(t *testing.T) {
+	cases := []struct {
+		name     string
+		change   func(c *Conf)
+		changes  []string
+		rejected []string
+	}{
+		{name: "no changes", change: func(c *Conf) {}},
+		{
+			name:    "mutable",
+			change:  func(c *Conf) { c.TG.RateLimit, c.Log.Level = 20, "debug" },
+			changes: []string{`tg.rateLimit: "25" -> "20"`, `log.level: "info" -> "debug"`},
+		},
+		{
+			name:    "channels",
+			change:  func(c *Conf) { c.TG.EsCanal = -1003 },
+			changes: []string{`tg.esCanal: "-1002" -> "-1003"`},
+		},
+		{
+			name:    "features",
+			change:  func(c *Conf) { c.Features = map[string]bool{"broadcast": false, "subscribers": true} },
+			changes: []string{"features.broadcast: true -> false", "features.subscribers: <нет> -> true"},
+		},
+		{
+			name: "messages",
+			change: func(c *Conf) {
+				c.Messages = map[string]map[string]interface{}{"ru": {"start": map[string]interface{}{"welcome": "Привет"}}}
+			},
+			changes: []string{"messages.ru.start.welcome: <нет> -> Привет"},
+		},
+		{
+			name:     "restart required",
+			change:   func(c *Conf) { c.TG.Token, c.TG.Admins = "654321:other", []int64{1} },
+			changes:  []string{`tg.token: *** -> ***`, `tg.admins: "[]" -> "[1]"`},
+			rejected: []string{"tg.token"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			old := validConf()
+			old.Features = map[string]bool{"broadcast": true}
+			next := validConf()
+			next.Features = map[string]bool{"broadcast": true}
+			tc.change(&next)
+
+			changes := diff("", reflect.ValueOf(old), reflect.ValueOf(next))
+			if !sameSet(changes, tc.changes) {
+				t.Errorf("diff() = %q, want %q", changes, tc.changes)
+			}
+			if rejected := restartRequired(changes); !slices.Equal(rejected, tc.rejected) {
+				t.Errorf("restartRequired() = %q, want %q", rejected, tc.rejected)
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	changes := []string{`tg.rateLimit: "25" -> "20"`, "features.broadcast: true -> false", "messages.ru.start.welcome: <нет> -> x"}
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"tg.rateLimit", true},
+		{"tg.rate", false},
+		{"tg", true},
+		{"features", true},
+		{"messages", true},
+		{"tg.admins", false},
+	}
+	for _, tc := range cases {
+		if got := Changed(changes, tc.key); got != tc.want {
+			t.Errorf("Changed(%q) = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
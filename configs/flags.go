@@ -0,0 +1,40 @@
+package configs
+
+import (
+	"strings"
+	"sync"
+)
+
+// Flags флаги функциональности из секции features, общие для компонентов бота.
+// Флаг, не заданный в файле, включен: features отключают функции без перезапуска
+type Flags struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+func NewFlags(flags map[string]bool) *Flags {
+	f := &Flags{}
+	f.Set(flags)
+	return f
+}
+
+// Set заменяет флаги, вызывается при перечитывании конфигурации
+func (f *Flags) Set(flags map[string]bool) {
+	next := make(map[string]bool, len(flags))
+	for name, enabled := range flags {
+		next[strings.ToLower(name)] = enabled
+	}
+
+	f.mu.Lock()
+	f.flags = next
+	f.mu.Unlock()
+}
+
+// Enabled сообщает, включена ли функция name
+func (f *Flags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	enabled, ok := f.flags[strings.ToLower(name)]
+	return !ok || enabled
+}
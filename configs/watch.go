@@ -0,0 +1,227 @@
+package configs
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"ibTgBot/internal/app/redact"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Параметры, которые применяются без перезапуска. Остальные читаются только при старте
+// (подключения, серверы, клиент и поллер Telegram, вывод логов), их изменение отклоняется
+var mutable = []string{
+	"tg.admins", "tg.rateLimit", "tg.errorChat", "tg.ruCanal", "tg.esCanal",
+	"log.level",
+	"features", "messages",
+}
+
+// Reload результат перечитывания конфигурации для уведомления администраторов
+type Reload struct {
+	Changes  []string // Примененные изменения
+	Rejected []string // Параметры, для смены которых требуется перезапуск
+	Err      error    // Ошибка чтения, проверки или применения конфигурации
+}
+
+// Watch отслеживает изменения файла конфигурации. Новая конфигурация
+// проверяется и передается в apply вместе со списком изменений.
+// Изменения, для которых нужен перезапуск, отклоняются целиком.
+// Результат каждого перечитывания передается в notify
+func (c *Conf) Watch(apply func(next *Conf, changes []string) error, notify func(Reload)) {
+	if _, err := os.Stat(c.path); err != nil {
+		slog.Warn("Отслеживание конфигурации отключено, файл недоступен", "path", c.path)
+		return
+	}
+
+	var mu sync.Mutex
+	current := c
+
+	file := viper.New()
+	file.SetConfigFile(c.path)
+	file.SetConfigType("hcl")
+	file.OnConfigChange(func(e fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		next, err := current.reload()
+		if err != nil {
+			slog.Error("Изменения конфигурации не применены", "error", err)
+			notify(Reload{Err: err})
+			return
+		}
+
+		changes := diff("", reflect.ValueOf(*current), reflect.ValueOf(*next))
+		if len(changes) == 0 {
+			return
+		}
+
+		if rejected := restartRequired(changes); len(rejected) > 0 {
+			slog.Error("Изменения конфигурации отклонены, для смены параметров требуется перезапуск бота",
+				"keys", rejected)
+			notify(Reload{Rejected: rejected})
+			return
+		}
+
+		if err := apply(next, changes); err != nil {
+			slog.Error("Изменения конфигурации не применены", "changes", changes, "error", err)
+			notify(Reload{Changes: changes, Err: err})
+			return
+		}
+
+		slog.Info("Конфигурация обновлена", "changes", changes)
+		current = next
+		notify(Reload{Changes: changes})
+	})
+	file.WatchConfig()
+
+	slog.Info("Отслеживание изменений конфигурации", "path", c.path)
+}
+
+// reload перечитывает конфигурацию с теми же флагами командной строки
+func (c *Conf) reload() (*Conf, error) {
+	keys := configKeys(reflect.TypeOf(Conf{}), "")
+
+	flags, err := parseFlags(keys, os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return load(c.path, keys, flags)
+}
+
+// restartRequired возвращает параметры из списка изменений, которые нельзя применить без перезапуска
+func restartRequired(changes []string) []string {
+	var rejected []string
+	for _, change := range changes {
+		key, _, _ := strings.Cut(change, ": ")
+		if !isMutable(key) {
+			rejected = append(rejected, key)
+		}
+	}
+	return rejected
+}
+
+// Changed сообщает, есть ли в списке изменений параметр key или элементы карты key
+func Changed(changes []string, key string) bool {
+	for _, change := range changes {
+		name, _, _ := strings.Cut(change, ": ")
+		if name == key || strings.HasPrefix(name, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isMutable проверяет параметр или элемент карты, например features.имя_флага
+func isMutable(key string) bool {
+	for _, prefix := range mutable {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// diff сравнивает две конфигурации по тегам mapstructure и возвращает
+// изменения вида "tg.timeout: 60 -> 90", значения секретов маскируются
+func diff(prefix string, old, next reflect.Value) []string {
+	var changes []string
+
+	for i := 0; i < old.NumField(); i++ {
+		tag := old.Type().Field(i).Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+
+		oldField, nextField := old.Field(i), next.Field(i)
+		switch oldField.Kind() {
+		case reflect.Struct:
+			changes = append(changes, diff(key, oldField, nextField)...)
+		case reflect.Map:
+			changes = append(changes, diffMap(key, oldField, nextField)...)
+		default:
+			if !reflect.DeepEqual(oldField.Interface(), nextField.Interface()) {
+				changes = append(changes, fmt.Sprintf("%s: %s -> %s",
+					key, display(key, oldField.Interface()), display(key, nextField.Interface())))
+			}
+		}
+	}
+
+	return changes
+}
+
+func diffMap(key string, old, next reflect.Value) []string {
+	names := make(map[string]struct{})
+	for _, name := range old.MapKeys() {
+		names[name.String()] = struct{}{}
+	}
+	for _, name := range next.MapKeys() {
+		names[name.String()] = struct{}{}
+	}
+
+	var changes []string
+	for name := range names {
+		oldValue := elem(old.MapIndex(reflect.ValueOf(name)))
+		nextValue := elem(next.MapIndex(reflect.ValueOf(name)))
+		if oldValue.IsValid() && nextValue.IsValid() && reflect.DeepEqual(oldValue.Interface(), nextValue.Interface()) {
+			continue
+		}
+		// Вложенные карты (messages.ru.*) сравниваются поэлементно
+		if isMap(oldValue) || isMap(nextValue) {
+			changes = append(changes, diffMap(key+"."+name, mapOrEmpty(oldValue), mapOrEmpty(nextValue))...)
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s.%s: %s -> %s", key, name, mapValue(oldValue), mapValue(nextValue)))
+	}
+	sort.Strings(changes)
+
+	return changes
+}
+
+// elem разворачивает значения interface{} из карт, прочитанных из файла
+func elem(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+func isMap(v reflect.Value) bool {
+	return v.IsValid() && v.Kind() == reflect.Map
+}
+
+func mapOrEmpty(v reflect.Value) reflect.Value {
+	if isMap(v) {
+		return v
+	}
+	return reflect.ValueOf(map[string]interface{}{})
+}
+
+func mapValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<нет>"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// display форматирует значение параметра для лога, скрывая секреты
+func display(key string, value interface{}) string {
+	lower := strings.ToLower(key)
+	if strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") {
+		return redact.Value(fmt.Sprint(value))
+	}
+	if lower == "tg.proxy" {
+		return redact.String(fmt.Sprint(value))
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
@@ -0,0 +1,231 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"html"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/metrics"
+	"ibTgBot/internal/app/redact"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sendTimeout   = 30 * time.Second // Сколько ждать отправки отчета
+	flushInterval = time.Minute      // Как часто отправлять накопленные отчеты
+	cooldown      = 10 * time.Minute // Одинаковая ошибка отправляется не чаще
+	maxPerFlush   = 10               // Остальные отчеты за интервал сводятся в одну строку
+)
+
+// Числа в тексте ошибки (ID, смещения, паузы) не влияют на группировку
+var reDigits = regexp.MustCompile(`\d+`)
+
+type Sender interface {
+	Send(ctx context.Context, to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error)
+}
+
+// entry накопленные повторы одной ошибки
+type entry struct {
+	key     string
+	source  string
+	err     string
+	attrs   []any // Контекст первого повтора
+	count   int   // Повторы с последней отправки
+	first   time.Time
+	last    time.Time
+	sent    time.Time
+	pending bool // Есть неотправленные повторы
+}
+
+// Alerts отправляет отчеты об ошибках в чат администраторов tg.errorChat.
+// Одинаковые ошибки объединяются в один отчет со счетчиком повторов
+type Alerts struct {
+	chat    atomic.Int64
+	snd     Sender
+	mu      sync.Mutex
+	entries map[string]*entry
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func New(conf *configs.Conf, snd Sender) *Alerts {
+	a := &Alerts{snd: snd, entries: make(map[string]*entry),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	a.SetChat(conf.GetTG().ErrorChat)
+	return a
+}
+
+// SetChat меняет чат для отчетов, вызывается и при перечитывании конфигурации
+func (a *Alerts) SetChat(chatId int64) {
+	a.chat.Store(chatId)
+}
+
+// Report учитывает ошибку с контекстом в виде пар ключ-значение, как в slog.
+// Отчет уходит при следующей отправке, вызывающий не ждет
+func (a *Alerts) Report(source string, err error, attrs ...any) {
+	if err == nil {
+		return
+	}
+	metrics.ErrorReports.WithLabelValues(source).Inc()
+	if a.chat.Load() == 0 {
+		return
+	}
+
+	// Ошибки telebot содержат URL запроса с токеном бота
+	text := redact.String(err.Error())
+	now := time.Now()
+	key := source + "|" + reDigits.ReplaceAllString(text, "N")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[key]
+	if !ok {
+		e = &entry{key: key, source: source}
+		a.entries[key] = e
+	}
+	if !e.pending {
+		e.err, e.attrs, e.count, e.first = text, attrs, 0, now
+		e.pending = true
+	}
+	e.count++
+	e.last = now
+}
+
+// Run периодически отправляет накопленные отчеты до вызова Stop
+func (a *Alerts) Run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.flush()
+		case <-a.stop:
+			a.flush()
+			return
+		}
+	}
+}
+
+// Stop останавливает Run и ждет отправки оставшихся отчетов
+func (a *Alerts) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+// flush отправляет отчеты, у которых истекла пауза после прошлой отправки.
+// За один раз уходит не больше maxPerFlush сообщений, остальные сводятся в одно.
+// Отчеты, которые не удалось отправить, остаются в очереди до следующей отправки
+func (a *Alerts) flush() {
+	chatId := a.chat.Load()
+	now := time.Now()
+
+	a.mu.Lock()
+	var due []entry
+	for key, e := range a.entries {
+		if !e.pending {
+			// Давно не повторявшиеся ошибки забываются
+			if now.Sub(e.sent) > cooldown {
+				delete(a.entries, key)
+			}
+			continue
+		}
+		if now.Sub(e.sent) < cooldown {
+			continue
+		}
+		due = append(due, *e)
+		e.pending, e.sent = false, now
+	}
+	a.mu.Unlock()
+
+	if chatId == 0 || len(due) == 0 {
+		return
+	}
+
+	// Сначала самые частые ошибки
+	sort.Slice(due, func(i, j int) bool { return due[i].count > due[j].count })
+
+	texts := make([]string, 0, maxPerFlush+1)
+	for i, e := range due {
+		if i == maxPerFlush {
+			texts = append(texts, summary(due[i:]))
+			break
+		}
+		texts = append(texts, format(e))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	for i, text := range texts {
+		if _, err := a.snd.Send(ctx, tele.ChatID(chatId), text, tele.ModeHTML, tele.NoPreview); err != nil {
+			slog.Warn("Failed to send error report", "chat_id", chatId, "error", err)
+			a.requeue(due[min(i, maxPerFlush):])
+			return
+		}
+	}
+}
+
+// requeue возвращает неотправленные отчеты в очередь вместе с повторами,
+// которые пришли во время отправки
+func (a *Alerts) requeue(unsent []entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, u := range unsent {
+		e, ok := a.entries[u.key]
+		if !ok {
+			e = &entry{key: u.key, source: u.source}
+			a.entries[u.key] = e
+		}
+		if e.pending {
+			u.count += e.count
+			u.last = e.last
+		}
+		*e = u
+	}
+}
+
+func format(e entry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⚠️ <b>%s</b>", html.EscapeString(e.source))
+	if e.count > 1 {
+		fmt.Fprintf(&sb, " ×%d <i>(%s – %s)</i>", e.count, e.first.Format(time.TimeOnly), e.last.Format(time.TimeOnly))
+	}
+	fmt.Fprintf(&sb, "\n<code>%s</code>\n", html.EscapeString(e.err))
+	for i := 0; i+1 < len(e.attrs); i += 2 {
+		fmt.Fprintf(&sb, "%s: %s\n", html.EscapeString(fmt.Sprint(e.attrs[i])), html.EscapeString(redact.String(fmt.Sprint(e.attrs[i+1]))))
+	}
+	return sb.String()
+}
+
+// summary сводит отчеты, не поместившиеся в лимит, в одно сообщение
+func summary(rest []entry) string {
+	counts := make(map[string]int)
+	for _, e := range rest {
+		counts[e.source] += e.count
+	}
+
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var sb strings.Builder
+	sb.WriteString(i18n.T(i18n.Fallback, "alerts.more", "count", len(rest)) + "\n")
+	for _, source := range sources {
+		fmt.Fprintf(&sb, "%s ×%d\n", html.EscapeString(source), counts[source])
+	}
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/configs"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSender запоминает отправленные отчеты, fail - число следующих отправок с ошибкой
+type fakeSender struct {
+	texts []string
+	fail  int
+}
+
+func (s *fakeSender) Send(_ context.Context, _ tele.Recipient, what interface{}, _ ...interface{}) (*tele.Message, error) {
+	if s.fail > 0 {
+		s.fail--
+		return nil, errors.New("telegram is unavailable")
+	}
+	s.texts = append(s.texts, what.(string))
+	return &tele.Message{}, nil
+}
+
+func newAlerts() (*Alerts, *fakeSender) {
+	conf := &configs.Conf{}
+	conf.TG.ErrorChat = -100
+	snd := &fakeSender{}
+	return New(conf, snd), snd
+}
+
+// rewind сдвигает время прошлой отправки всех отчетов, имитируя прошедшее время
+func (a *Alerts) rewind(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range a.entries {
+		e.sent = e.sent.Add(-d)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	cases := []struct {
+		name    string
+		reports [][2]string // source, error
+		want    []string    // Фрагменты отправленных сообщений по порядку
+	}{
+		{
+			name:    "same error",
+			reports: [][2]string{{"db", "timeout after 5s"}, {"db", "timeout after 7s"}, {"db", "timeout after 9s"}},
+			want:    []string{"db</b> ×3"},
+		},
+		{
+			name:    "different sources",
+			reports: [][2]string{{"db", "timeout"}, {"kafka", "timeout"}, {"kafka", "timeout"}},
+			want:    []string{"kafka</b> ×2", "<b>db</b>\n"},
+		},
+		{
+			name:    "no reports",
+			reports: nil,
+			want:    nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, snd := newAlerts()
+			for _, r := range tc.reports {
+				a.Report(r[0], errors.New(r[1]))
+			}
+			a.flush()
+
+			if len(snd.texts) != len(tc.want) {
+				t.Fatalf("sent %d reports, want %d: %q", len(snd.texts), len(tc.want), snd.texts)
+			}
+			for i, want := range tc.want {
+				if !strings.Contains(snd.texts[i], want) {
+					t.Errorf("report %d = %q, want it to contain %q", i, snd.texts[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	steps := []struct {
+		name    string
+		reports int           // Повторы ошибки перед отправкой
+		elapsed time.Duration // Сколько прошло с прошлой отправки
+		want    string        // Пусто - отчет не отправляется
+	}{
+		{name: "first report", reports: 1, want: "<b>db</b>\n"},
+		{name: "repeat within cooldown", reports: 2, elapsed: time.Minute},
+		{name: "still within cooldown", reports: 1, elapsed: 5 * time.Minute},
+		{name: "cooldown passed", elapsed: cooldown, want: "db</b> ×3"},
+		{name: "nothing new", elapsed: cooldown},
+	}
+
+	a, snd := newAlerts()
+	for _, step := range steps {
+		for i := 0; i < step.reports; i++ {
+			a.Report("db", errors.New("connection refused"))
+		}
+		a.rewind(step.elapsed)
+
+		sent := len(snd.texts)
+		a.flush()
+
+		switch {
+		case step.want == "" && len(snd.texts) != sent:
+			t.Errorf("%s: unexpected report %q", step.name, snd.texts[sent:])
+		case step.want != "" && len(snd.texts) != sent+1:
+			t.Errorf("%s: sent %d reports, want 1", step.name, len(snd.texts)-sent)
+		case step.want != "" && !strings.Contains(snd.texts[sent], step.want):
+			t.Errorf("%s: report = %q, want it to contain %q", step.name, snd.texts[sent], step.want)
+		}
+	}
+
+	// Отчет, не повторявшийся дольше паузы, забывается
+	a.rewind(cooldown + time.Second)
+	a.flush()
+	if len(a.entries) != 0 {
+		t.Errorf("entries = %d after idle cooldown, want 0", len(a.entries))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	a, snd := newAlerts()
+	for i := 0; i < maxPerFlush+3; i++ {
+		a.Report(fmt.Sprintf("source%c", 'a'+i), errors.New("failed"))
+	}
+	a.flush()
+
+	if len(snd.texts) != maxPerFlush+1 {
+		t.Fatalf("sent %d reports, want %d", len(snd.texts), maxPerFlush+1)
+	}
+	if got := snd.texts[maxPerFlush]; !strings.Contains(got, "И еще 3 вида ошибок") {
+		t.Errorf("summary = %q", got)
+	}
+}
+
+func TestRetryUnsent(t *testing.T) {
+	a, snd := newAlerts()
+	a.Report("db", errors.New("timeout"))
+	a.Report("db", errors.New("timeout"))
+	snd.fail = 1
+	a.flush()
+	if len(snd.texts) != 0 {
+		t.Fatalf("sent %q while sender fails", snd.texts)
+	}
+
+	// Повтор после неудачной отправки добавляется к отложенному отчету
+	a.Report("db", errors.New("timeout"))
+	a.flush()
+	if len(snd.texts) != 1 || !strings.Contains(snd.texts[0], "db</b> ×3") {
+		t.Errorf("retry sent %q, want one report with ×3", snd.texts)
+	}
+}
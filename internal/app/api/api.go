@@ -0,0 +1,467 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/db"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/metrics"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Ограничения выборок и тела запроса
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+	tagsLimit    = 999
+	maxBody      = 1 << 20
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+type DB interface {
+	SearchUsers(query, lang string, limit, offset int) ([]db.User, error)
+	GetUser(userId int64) (*db.User, error)
+	DeactivateUser(userId int64) error
+	ManageCategories(userId int64, tagId *int) (string, error)
+	SetCategories(userId int64, tagIds []int) error
+	ReadTags(limit int, mainTag bool, lang string) ([]db.Tag, error)
+	CreateTag(lang, value string) (int, error)
+	SetTagValue(tagId int, lang, value string) error
+	SetTagActive(tagId int, active bool) error
+	MoveTag(tagId, position int) error
+	DeleteTag(tagId int) error
+}
+
+type Tags interface {
+	Changed(lang string) error
+}
+
+type Sender interface {
+	Send(ctx context.Context, to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error)
+}
+
+// API REST интерфейс администрирования для других сервисов Infobot
+type API struct {
+	srv   *http.Server
+	token string
+	d     DB
+	t     Tags
+	snd   Sender
+}
+
+func New(conf *configs.Conf, d DB, t Tags, snd Sender) *API {
+	a := &API{token: conf.API.Token, d: d, t: t, snd: snd}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/openapi.yaml", a.OpenAPI)
+
+	mux.Handle("GET /api/v1/users", a.auth(a.ListUsers))
+	mux.Handle("GET /api/v1/users/{id}", a.auth(a.GetUser))
+	mux.Handle("POST /api/v1/users/{id}/deactivate", a.auth(a.DeactivateUser))
+	mux.Handle("GET /api/v1/users/{id}/subscriptions", a.auth(a.GetSubscriptions))
+	mux.Handle("PUT /api/v1/users/{id}/subscriptions", a.auth(a.SetSubscriptions))
+
+	mux.Handle("GET /api/v1/tags", a.auth(a.ListTags))
+	mux.Handle("POST /api/v1/tags", a.auth(a.CreateTag))
+	mux.Handle("PUT /api/v1/tags/{id}", a.auth(a.UpdateTag))
+	mux.Handle("DELETE /api/v1/tags/{id}", a.auth(a.DeleteTag))
+
+	mux.Handle("POST /api/v1/messages", a.auth(a.SendMessage))
+
+	a.srv = &http.Server{Addr: conf.API.Listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return a
+}
+
+// Run запускает HTTP сервер API, пустой адрес отключает API
+func (a *API) Run() error {
+	if a.srv.Addr == "" {
+		slog.Info("Admin API disabled")
+		return nil
+	}
+
+	slog.Info("Admin API started", "listen", a.srv.Addr)
+	if err := a.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (a *API) Stop(ctx context.Context) error {
+	return a.srv.Shutdown(ctx)
+}
+
+// auth проверяет заголовок Authorization: Bearer <token>
+func (a *API) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			slog.Warn("Unauthorized API request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *API) OpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPI)
+}
+
+// ListUsers GET /api/v1/users?q=&lang=&limit=&offset=
+func (a *API) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+		return
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	users, err := a.d.SearchUsers(query.Get("q"), query.Get("lang"), limit, offset)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// GetUser GET /api/v1/users/{id}
+func (a *API) GetUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := a.d.GetUser(userId)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// DeactivateUser POST /api/v1/users/{id}/deactivate
+func (a *API) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.d.DeactivateUser(userId); err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	slog.Info("User deactivated via API", "user_id", userId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type subscriptions struct {
+	Tags []int `json:"tags"`
+}
+
+// GetSubscriptions GET /api/v1/users/{id}/subscriptions
+func (a *API) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := a.d.ManageCategories(userId, nil)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+
+	result := subscriptions{Tags: []int{}}
+	if categories != "" {
+		if err := json.Unmarshal([]byte(categories), &result.Tags); err != nil {
+			a.internalError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// SetSubscriptions PUT /api/v1/users/{id}/subscriptions {"tags": [1, 2]}
+func (a *API) SetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdParam(w, r)
+	if !ok {
+		return
+	}
+
+	var body subscriptions
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	if err := a.d.SetCategories(userId, body.Tags); err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	slog.Info("User subscriptions set via API", "user_id", userId, "tags", body.Tags)
+	writeJSON(w, http.StatusOK, body)
+}
+
+// ListTags GET /api/v1/tags?lang=ru&main=true&active=true
+func (a *API) ListTags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lang := query.Get("lang")
+	if lang == "" {
+		writeError(w, http.StatusBadRequest, "lang is required")
+		return
+	}
+
+	tags, err := a.d.ReadTags(tagsLimit, query.Get("main") == "true", lang)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+
+	// БД возвращает и неактивные теги, фильтр по активности применяется здесь
+	if query.Get("active") == "true" {
+		active := make([]db.Tag, 0, len(tags))
+		for _, tag := range tags {
+			if tag.Active {
+				active = append(active, tag)
+			}
+		}
+		tags = active
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+type createTagRequest struct {
+	Lang  string `json:"lang"`
+	Value string `json:"value"`
+}
+
+// updateTagRequest поля, которые меняет UpdateTag. Неизвестные поля отклоняет readJSON
+type updateTagRequest struct {
+	Lang     string `json:"lang"`
+	Value    string `json:"value"`
+	Active   *bool  `json:"active"`
+	Position *int   `json:"position"`
+}
+
+// CreateTag POST /api/v1/tags {"lang": "ru", "value": "Название"}
+func (a *API) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var body createTagRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	body.Value = strings.TrimSpace(body.Value)
+	if body.Lang == "" || body.Value == "" {
+		writeError(w, http.StatusBadRequest, "lang and value are required")
+		return
+	}
+	if !isLang(body.Lang) {
+		writeError(w, http.StatusBadRequest, "unknown lang: "+body.Lang)
+		return
+	}
+
+	tagId, err := a.d.CreateTag(body.Lang, body.Value)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	slog.Info("Tag created via API", "tag_id", tagId, "lang", body.Lang)
+	// Изменение уже в БД, ошибка обновления каталога записана в лог, реплики
+	// перечитают каталог по расписанию
+	_ = a.t.Changed("")
+	writeJSON(w, http.StatusCreated, map[string]int{"id": tagId})
+}
+
+// UpdateTag PUT /api/v1/tags/{id}, все поля необязательны, но хотя бы одно задано:
+// {"lang": "es", "value": "Nombre", "active": true, "position": 3}.
+// Хранимые процедуры меняют поля по одному и без общей транзакции, поэтому все поля
+// и существование тега проверяются до первой записи
+func (a *API) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	tagId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	var body updateTagRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	body.Value = strings.TrimSpace(body.Value)
+	switch {
+	case body.Lang == "" && body.Value == "" && body.Active == nil && body.Position == nil:
+		writeError(w, http.StatusBadRequest, "nothing to update")
+		return
+	case (body.Lang == "") != (body.Value == ""):
+		writeError(w, http.StatusBadRequest, "lang and value must be set together")
+		return
+	case body.Lang != "" && !isLang(body.Lang):
+		writeError(w, http.StatusBadRequest, "unknown lang: "+body.Lang)
+		return
+	case body.Position != nil && *body.Position < 1:
+		writeError(w, http.StatusBadRequest, "position must be positive")
+		return
+	}
+
+	found, err := a.tagExists(tagId)
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "tag not found")
+		return
+	}
+
+	if body.Value != "" {
+		err = a.d.SetTagValue(tagId, body.Lang, body.Value)
+	}
+	if err == nil && body.Active != nil {
+		err = a.d.SetTagActive(tagId, *body.Active)
+	}
+	if err == nil && body.Position != nil {
+		err = a.d.MoveTag(tagId, *body.Position)
+	}
+	if err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+
+	slog.Info("Tag updated via API", "tag_id", tagId)
+	_ = a.t.Changed("")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tagExists ищет тег среди тегов всех языков, включая неактивные
+func (a *API) tagExists(tagId int) (bool, error) {
+	for _, lang := range i18n.Langs() {
+		tags, err := a.d.ReadTags(tagsLimit, false, lang)
+		if err != nil {
+			return false, err
+		}
+		for _, tag := range tags {
+			if tag.ID == tagId {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isLang проверяет, что для языка есть каталог сообщений
+func isLang(lang string) bool {
+	return slices.Contains(i18n.Langs(), lang)
+}
+
+// DeleteTag DELETE /api/v1/tags/{id}
+func (a *API) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tagId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	if err := a.d.DeleteTag(tagId); err != nil {
+		a.internalError(w, r, err)
+		return
+	}
+	slog.Info("Tag deleted via API", "tag_id", tagId)
+	_ = a.t.Changed("")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type messageRequest struct {
+	ChatID              int64  `json:"chat_id"`
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode"`
+	DisableNotification bool   `json:"disable_notification"`
+}
+
+// SendMessage POST /api/v1/messages {"chat_id": 1, "text": "<b>Текст</b>", "parse_mode": "HTML"}
+func (a *API) SendMessage(w http.ResponseWriter, r *http.Request) {
+	var body messageRequest
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.ChatID == 0 || body.Text == "" {
+		writeError(w, http.StatusBadRequest, "chat_id and text are required")
+		return
+	}
+
+	msg, err := a.snd.Send(r.Context(), tele.ChatID(body.ChatID), body.Text, &tele.SendOptions{
+		ParseMode:           tele.ParseMode(body.ParseMode),
+		DisableNotification: body.DisableNotification,
+	})
+	if err != nil {
+		// Текст ошибки telebot может содержать URL запроса с токеном бота, клиенту
+		// возвращается только класс ошибки, подробности остаются в логе с маскировкой секретов
+		slog.Warn("API message send failed", "chat_id", body.ChatID, "error", err)
+		writeError(w, http.StatusBadGateway, "telegram send failed: "+metrics.ErrorClass(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"message_id": msg.ID})
+}
+
+func (a *API) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("API request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func userIdParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return 0, false
+	}
+	return userId, true
+}
+
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write API response", "error", err)
+	}
+}
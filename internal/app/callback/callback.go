@@ -0,0 +1,105 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version версия формата данных кнопок. Кнопки с другой версией считаются устаревшими,
+// версию нужно увеличивать при несовместимых изменениях действий или их параметров
+const Version = 1
+
+// Ограничение Telegram на callback_data
+const MaxLen = 64
+
+const (
+	sep    = "|"
+	sigLen = 8 // Байт подписи HMAC, в данных 11 символов base64url
+)
+
+var (
+	// ErrStale кнопка другой версии или неизвестного формата
+	ErrStale = errors.New("callback: stale data")
+	// ErrSignature подпись не совпадает: данные изменены или кнопку нажал другой пользователь
+	ErrSignature = errors.New("callback: invalid signature")
+)
+
+// Data параметры нажатой кнопки
+type Data struct {
+	Action string // Короткий код действия
+	Page   int    // Страница меню
+	ID     int64  // ID тега или пользователя
+	Arg    string // Короткий строковый параметр, например язык
+}
+
+// Codec кодирует Data в callback_data вида <версия>|<действие>|<страница>|<ID>|<параметр>|<подпись>,
+// числа в base36. Подпись HMAC-SHA256 учитывает ID пользователя, которому отправлена кнопка
+type Codec struct {
+	key []byte
+}
+
+// New создает кодек. С пустым ключом данные не подписываются
+func New(key []byte) *Codec {
+	return &Codec{key: key}
+}
+
+// Encode кодирует данные кнопки для пользователя userId. Паникует, если параметры
+// содержат разделитель или не помещаются в MaxLen: это ошибка в коде меню
+func (c *Codec) Encode(userId int64, d Data) string {
+	if strings.Contains(d.Action, sep) || strings.Contains(d.Arg, sep) {
+		panic(fmt.Sprintf("callback: separator in %+v", d))
+	}
+
+	payload := strings.Join([]string{
+		strconv.Itoa(Version),
+		d.Action,
+		strconv.FormatInt(int64(d.Page), 36),
+		strconv.FormatInt(d.ID, 36),
+		d.Arg,
+	}, sep)
+	data := payload + sep + c.sign(userId, payload)
+
+	if len(data) > MaxLen {
+		panic(fmt.Sprintf("callback: %d bytes exceed limit: %q", len(data), data))
+	}
+	return data
+}
+
+// Decode разбирает callback_data кнопки, нажатой пользователем userId
+func (c *Codec) Decode(userId int64, data string) (Data, error) {
+	parts := strings.Split(data, sep)
+	if len(parts) != 6 || parts[0] != strconv.Itoa(Version) {
+		return Data{}, ErrStale
+	}
+
+	payload := strings.Join(parts[:5], sep)
+	if !hmac.Equal([]byte(parts[5]), []byte(c.sign(userId, payload))) {
+		return Data{}, ErrSignature
+	}
+
+	page, err := strconv.ParseInt(parts[2], 36, 32)
+	if err != nil {
+		return Data{}, ErrStale
+	}
+	id, err := strconv.ParseInt(parts[3], 36, 64)
+	if err != nil {
+		return Data{}, ErrStale
+	}
+
+	return Data{Action: parts[1], Page: int(page), ID: id, Arg: parts[4]}, nil
+}
+
+func (c *Codec) sign(userId int64, payload string) string {
+	if len(c.key) == 0 {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(strconv.FormatInt(userId, 36) + sep + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sigLen])
+}
@@ -0,0 +1,80 @@
+package callback
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+func TestRoundTrip(t *testing.T) {
+	c := New(key)
+	cases := []Data{
+		{},
+		{Action: "c", Page: 3, ID: 42},
+		{Action: "bg", ID: 7, Arg: "es"},
+		{Action: "cg", Page: -1, ID: -100500},
+	}
+	for _, want := range cases {
+		data := c.Encode(123456789, want)
+		got, err := c.Decode(123456789, data)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", data, err)
+		}
+		if got != want {
+			t.Errorf("Decode(%q) = %+v, want %+v", data, got, want)
+		}
+	}
+}
+
+func TestTamperedPayload(t *testing.T) {
+	c := New(key)
+	data := c.Encode(1, Data{Action: "c", ID: 5})
+
+	tampered := strings.Replace(data, "|5|", "|6|", 1)
+	if tampered == data {
+		t.Fatalf("payload not changed: %q", data)
+	}
+	if _, err := c.Decode(1, tampered); !errors.Is(err, ErrSignature) {
+		t.Errorf("Decode(%q) error = %v, want ErrSignature", tampered, err)
+	}
+}
+
+func TestOtherUser(t *testing.T) {
+	c := New(key)
+	data := c.Encode(1, Data{Action: "md", ID: 5})
+
+	if _, err := c.Decode(2, data); !errors.Is(err, ErrSignature) {
+		t.Errorf("Decode by other user error = %v, want ErrSignature", err)
+	}
+}
+
+func TestVersionBump(t *testing.T) {
+	c := New(key)
+	data := c.Encode(1, Data{Action: "c", ID: 5})
+
+	_, rest, _ := strings.Cut(data, sep)
+	for _, version := range []int{Version - 1, Version + 1} {
+		old := strconv.Itoa(version) + sep + rest
+		if _, err := c.Decode(1, old); !errors.Is(err, ErrStale) {
+			t.Errorf("Decode(%q) error = %v, want ErrStale", old, err)
+		}
+	}
+}
+
+func TestWorstCaseLen(t *testing.T) {
+	c := New(key)
+	d := Data{Action: "cg", Page: math.MinInt32, ID: math.MinInt64, Arg: "ru"}
+
+	data := c.Encode(math.MinInt64, d)
+	if len(data) > MaxLen {
+		t.Fatalf("len(%q) = %d, want <= %d", data, len(data), MaxLen)
+	}
+	got, err := c.Decode(math.MinInt64, data)
+	if err != nil || got != d {
+		t.Errorf("Decode(%q) = %+v, %v, want %+v", data, got, err, d)
+	}
+}
@@ -1,23 +1,112 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"ibTgBot/configs"
+	"ibTgBot/internal/app/metrics"
 	"log"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type DB struct {
-	dsn string
+	pool *sql.DB
+	a    Alerts
+}
+
+// Alerts получает ошибки вызовов БД для отчета администраторам
+type Alerts interface {
+	Report(source string, err error, attrs ...any)
 }
 
 type Tag struct {
-	ID    int    `json:"id"`
-	Value string `json:"value"`
+	ID       int    `json:"id"`
+	Value    string `json:"value"`
+	Active   bool   `json:"active"`
+	Position int    `json:"position"`
+	Parent   int    `json:"parent"` // ID основного тега, 0 у основных тегов
+}
+
+// User карточка пользователя бота
+type User struct {
+	ID         int64  `json:"id"`
+	UserName   string `json:"userName"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	Lang       string `json:"lang"`
+	Blocked    bool   `json:"blocked"`
+	Created    string `json:"created"`
+	Categories []int  `json:"categories"`
+}
+
+type GetUserIn interface {
+	GetUser(userId int64) (*User, error)
+}
+
+type GetUsersIn interface {
+	GetUsers(lang string) ([]int64, error)
+}
+
+// Stats агрегированная статистика бота для команды /stats
+type Stats struct {
+	TotalUsers   int            `json:"totalUsers"`
+	ActiveUsers  int            `json:"activeUsers"`
+	BlockedUsers int            `json:"blockedUsers"`
+	UsersByLang  map[string]int `json:"usersByLang"`
+	TopTags      []TagStat      `json:"topTags"`
+	NewUsers     []DayStat      `json:"newUsers"` // За последние 7 дней
+	Delivered24h int            `json:"delivered24h"`
+}
+
+type TagStat struct {
+	TagID       int    `json:"tagId"`
+	Lang        string `json:"lang"`
+	Subscribers int    `json:"subscribers"`
+}
+
+type DayStat struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+type StatsIn interface {
+	Stats(topN int) (*Stats, error)
+}
+
+type SetUserLangIn interface {
+	SetUserLang(userId int64, lang string) error
+}
+
+type SetReferrerIn interface {
+	SetReferrer(userId, referrerId int64) error
+}
+
+type SetBlockedIn interface {
+	SetBlocked(userId int64, blocked bool) error
+}
+
+type LogDeliveriesIn interface {
+	LogDeliveries(kind string, count int) error
+}
+
+type ManageTagsIn interface {
+	CreateTag(lang, value string) (int, error)
+	SetTagValue(tagId int, lang, value string) error
+	SetTagActive(tagId int, active bool) error
+	MoveTag(tagId, position int) error
+	DeleteTag(tagId int) error
+}
+
+type ManageUsersIn interface {
+	SearchUsers(query, lang string, limit, offset int) ([]User, error)
+	DeactivateUser(userId int64) error
+	SetCategories(userId int64, tagIds []int) error
 }
 
 type GetSubscribersIn interface {
@@ -29,11 +118,11 @@ type CreateUserIn interface {
 }
 
 type ReadTagsIn interface {
-	SQLReadTags(limit int, mainTag bool, lang string) ([]Tag, error)
+	ReadTags(limit int, mainTag bool, lang string) ([]Tag, error)
 }
 
 type SetMsgIdIn interface {
-	SQLSetMsgId(msgId int, urlId, lang string)
+	SetMsgId(msgId int, urlId, lang string)
 }
 
 type ManageCategoriesIn interface {
@@ -41,40 +130,78 @@ type ManageCategoriesIn interface {
 }
 
 func New(conf *configs.Conf) *DB {
-	return &DB{
-		dsn: fmt.Sprintf("%s:%s@tcp(%s)/%s", conf.GetDB().User, conf.GetDB().Password, conf.GetDB().Host, conf.GetDB().Name),
+	// Драйвер пишет свои ошибки через стандартный логгер, который направлен в slog
+	_ = mysql.SetLogger(log.Default())
+
+	dsn := mysql.NewConfig()
+	dsn.User = conf.GetDB().User
+	dsn.Passwd = conf.GetDB().Password
+	dsn.Net = "tcp"
+	dsn.Addr = conf.GetDB().Host
+	dsn.DBName = conf.GetDB().Name
+
+	// sql.Open не устанавливает соединение, ошибка возможна только для неизвестного драйвера
+	pool, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		panic(err)
 	}
+	pool.SetMaxOpenConns(20)
+	pool.SetMaxIdleConns(5)
+	pool.SetConnMaxLifetime(3 * time.Minute)
+
+	return &DB{pool: pool}
+}
+
+// SetAlerts подключает отчеты об ошибках, вызывается до начала работы с БД
+func (d *DB) SetAlerts(a Alerts) {
+	d.a = a
+}
+
+// observe учитывает время вызова БД, ошибки отправляются в отчет администраторам
+func (d *DB) observe(operation string, start time.Time, err *error) {
+	metrics.ObserveDB(operation, start, err)
+	if d.a != nil && *err != nil {
+		d.a.Report("db", *err, "operation", operation)
+	}
+}
+
+// Ping проверяет доступность БД, используется проверкой готовности
+func (d *DB) Ping(ctx context.Context) error {
+	return d.pool.PingContext(ctx)
+}
+
+func (d *DB) Close() error {
+	return d.pool.Close()
 }
 
-func (d *DB) SQLSetMsgId(msgId int, urlId, lang string) {
+func (d *DB) SetMsgId(msgId int, urlId, lang string) {
+	var err error
+	defer d.observe("SetTgMsg", time.Now(), &err)
+
 	urlIdInt, err := strconv.Atoi(urlId)
 	if err != nil {
-		log.Printf("Failed to convert urlId to int: %s", err)
+		slog.Error("Failed to convert urlId to int", "url_id", urlId, "error", err)
 		return
 	}
 
-	db, err := sql.Open("mysql", d.dsn)
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
+	db := d.pool
 
 	// Вызов хранимой процедуры SetTgMsg
 	_, err = db.Exec("CALL SetTgMsg(?, ?, ?)", lang, urlIdInt, msgId)
 	if err != nil {
-		log.Printf("Failed to call stored procedure: %s", err)
+		slog.Error("Failed to call stored procedure", "procedure", "SetTgMsg", "url_id", urlId, "lang", lang, "error", err)
 		return
 	}
 
-	log.Println("Set Tg msgId successfully for urlId:", urlId)
+	slog.Info("Set Tg msgId successfully", "url_id", urlId, "msg_id", msgId, "lang", lang)
 }
 
-func (d *DB) SQLReadTags(limit int, mainTag bool, lang string) ([]Tag, error) {
-	db, err := sql.Open("mysql", d.dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
+// ReadTags возвращает теги языка в порядке позиций, включая неактивные.
+// mainTag=true оставляет только основные теги, false возвращает и подтеги
+func (d *DB) ReadTags(limit int, mainTag bool, lang string) (_ []Tag, err error) {
+	defer d.observe("ReadTags", time.Now(), &err)
+
+	db := d.pool
 
 	var result string
 	err = db.QueryRow("SELECT ib_tg_ReadTags(?, ?, ?)", limit, mainTag, lang).Scan(&result)
@@ -91,12 +218,10 @@ func (d *DB) SQLReadTags(limit int, mainTag bool, lang string) ([]Tag, error) {
 	return tags, nil
 }
 
-func (d *DB) CreateUser(userId int64, userName, firstName, lastName, lang string) error {
-	db, err := sql.Open("mysql", d.dsn)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
+func (d *DB) CreateUser(userId int64, userName, firstName, lastName, lang string) (err error) {
+	defer d.observe("CreateUser", time.Now(), &err)
+
+	db := d.pool
 
 	_, err = db.Exec("CALL ib_tg_CreateUser(?, ?, ?, ?, ?)", userId, userName, firstName, lastName, lang)
 	if err != nil {
@@ -106,12 +231,10 @@ func (d *DB) CreateUser(userId int64, userName, firstName, lastName, lang string
 	return nil
 }
 
-func (d *DB) ManageCategories(userId int64, tagId *int) (string, error) {
-	db, err := sql.Open("mysql", d.dsn)
-	if err != nil {
-		return "", fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
+func (d *DB) ManageCategories(userId int64, tagId *int) (_ string, err error) {
+	defer d.observe("ManageCategories", time.Now(), &err)
+
+	db := d.pool
 
 	var categories string
 
@@ -132,12 +255,10 @@ func (d *DB) ManageCategories(userId int64, tagId *int) (string, error) {
 	return categories, nil
 }
 
-func (d *DB) GetSubscribers(tagId, lang string) ([]int, error) {
-	db, err := sql.Open("mysql", d.dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
+func (d *DB) GetSubscribers(tagId, lang string) (_ []int, err error) {
+	defer d.observe("GetSubscribers", time.Now(), &err)
+
+	db := d.pool
 
 	var result string
 	err = db.QueryRow("SELECT ib_tg_GetSubscribers(?, ?)", tagId, lang).Scan(&result)
@@ -163,3 +284,237 @@ func (d *DB) GetSubscribers(tagId, lang string) ([]int, error) {
 
 	return subscribers, nil
 }
+
+// GetUser возвращает пользователя по Telegram ID, nil если пользователь не найден
+func (d *DB) GetUser(userId int64) (_ *User, err error) {
+	defer d.observe("GetUser", time.Now(), &err)
+
+	var result sql.NullString
+	err = d.pool.QueryRow("SELECT ib_tg_GetUser(?)", userId).Scan(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call stored function: %w", err)
+	}
+
+	if !result.Valid || result.String == "" {
+		return nil, nil
+	}
+
+	var user User
+	err = json.Unmarshal([]byte(result.String), &user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUsers возвращает ID активных пользователей, пустой lang возвращает пользователей всех языков
+func (d *DB) GetUsers(lang string) (_ []int64, err error) {
+	defer d.observe("GetUsers", time.Now(), &err)
+
+	var result string
+	err = d.pool.QueryRow("SELECT ib_tg_GetUsers(NULLIF(?, ''))", lang).Scan(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call stored function: %w", err)
+	}
+
+	return parseIds(result)
+}
+
+// parseIds разбирает список ID через запятую, который возвращают хранимые функции
+func parseIds(result string) ([]int64, error) {
+	if result == "" {
+		return []int64{}, nil
+	}
+
+	stringIds := strings.Split(result, ",")
+	ids := make([]int64, len(stringIds))
+	for i, idStr := range stringIds {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert id to int: %w", err)
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+// Stats возвращает агрегированную статистику, topN ограничивает список тегов
+func (d *DB) Stats(topN int) (_ *Stats, err error) {
+	defer d.observe("Stats", time.Now(), &err)
+
+	var result string
+	err = d.pool.QueryRow("SELECT ib_tg_Stats(?)", topN).Scan(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call stored function: %w", err)
+	}
+
+	var stats Stats
+	err = json.Unmarshal([]byte(result), &stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// SetBlocked отмечает пользователя, заблокировавшего бота, такие пользователи не получают рассылки
+func (d *DB) SetBlocked(userId int64, blocked bool) (err error) {
+	defer d.observe("SetBlocked", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_SetBlocked(?, ?)", userId, blocked)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserLang сохраняет выбранный пользователем язык интерфейса и рассылок
+func (d *DB) SetUserLang(userId int64, lang string) (err error) {
+	defer d.observe("SetUserLang", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_SetUserLang(?, ?)", userId, lang)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// SetReferrer запоминает пользователя, по чьей ссылке пришел новый пользователь
+func (d *DB) SetReferrer(userId, referrerId int64) (err error) {
+	defer d.observe("SetReferrer", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_SetReferrer(?, ?)", userId, referrerId)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// LogDeliveries учитывает доставленные сообщения для статистики: subscribers или broadcast
+func (d *DB) LogDeliveries(kind string, count int) (err error) {
+	defer d.observe("LogDeliveries", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_LogDeliveries(?, ?)", kind, count)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// CreateTag создает тег с названием на указанном языке и возвращает его ID
+func (d *DB) CreateTag(lang, value string) (_ int, err error) {
+	defer d.observe("CreateTag", time.Now(), &err)
+
+	var tagId int
+	err = d.pool.QueryRow("SELECT ib_tg_CreateTag(?, ?)", lang, value).Scan(&tagId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call stored function: %w", err)
+	}
+
+	return tagId, nil
+}
+
+// SetTagValue задает название тега на языке: переименование или перевод
+func (d *DB) SetTagValue(tagId int, lang, value string) (err error) {
+	defer d.observe("SetTagValue", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_SetTagValue(?, ?, ?)", tagId, lang, value)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// SetTagActive включает или отключает тег, неактивные теги не попадают в меню пользователей
+func (d *DB) SetTagActive(tagId int, active bool) (err error) {
+	defer d.observe("SetTagActive", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_SetTagActive(?, ?)", tagId, active)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// MoveTag переносит тег на позицию в порядке вывода, позиции считаются с 1
+func (d *DB) MoveTag(tagId, position int) (err error) {
+	defer d.observe("MoveTag", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_MoveTag(?, ?)", tagId, position)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTag удаляет тег вместе с переводами и подписками на него
+func (d *DB) DeleteTag(tagId int) (err error) {
+	defer d.observe("DeleteTag", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_DeleteTag(?)", tagId)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// SearchUsers ищет пользователей по имени, username или ID, пустые query и lang не ограничивают выборку
+func (d *DB) SearchUsers(query, lang string, limit, offset int) (_ []User, err error) {
+	defer d.observe("SearchUsers", time.Now(), &err)
+
+	var result string
+	err = d.pool.QueryRow("SELECT ib_tg_SearchUsers(NULLIF(?, ''), NULLIF(?, ''), ?, ?)", query, lang, limit, offset).Scan(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call stored function: %w", err)
+	}
+
+	users := []User{}
+	err = json.Unmarshal([]byte(result), &users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return users, nil
+}
+
+// DeactivateUser отключает пользователя, он перестает получать сообщения
+func (d *DB) DeactivateUser(userId int64) (err error) {
+	defer d.observe("DeactivateUser", time.Now(), &err)
+
+	_, err = d.pool.Exec("CALL ib_tg_DeactivateUser(?)", userId)
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
+
+// SetCategories заменяет подписки пользователя указанным списком тегов
+func (d *DB) SetCategories(userId int64, tagIds []int) (err error) {
+	defer d.observe("SetCategories", time.Now(), &err)
+
+	if tagIds == nil {
+		tagIds = []int{}
+	}
+	categories, err := json.Marshal(tagIds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal categories: %w", err)
+	}
+
+	_, err = d.pool.Exec("CALL ib_tg_SetCategories(?, ?)", userId, string(categories))
+	if err != nil {
+		return fmt.Errorf("failed to call stored procedure: %w", err)
+	}
+
+	return nil
+}
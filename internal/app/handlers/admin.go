@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"html"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/redact"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetAdmins заменяет список администраторов, вызывается и при перечитывании конфигурации
+func (h *Handlers) SetAdmins(admins []int64) {
+	keep := make(map[int64]bool, len(admins))
+	for _, id := range admins {
+		keep[id] = true
+	}
+
+	var removed []int64
+	h.admins.Range(func(key, _ any) bool {
+		if id := key.(int64); !keep[id] {
+			removed = append(removed, id)
+			h.admins.Delete(key)
+		}
+		return true
+	})
+	for _, id := range admins {
+		h.admins.Store(id, struct{}{})
+	}
+
+	// Меню команд администраторов обновляется, если бот уже запущен,
+	// у бывших администраторов меню команд администратора удаляется
+	select {
+	case <-h.s.GetBotReady():
+		if len(removed) > 0 {
+			go h.deleteAdminCommands(removed)
+		}
+	default:
+	}
+	h.RefreshCommands()
+}
+
+// NotifyReload сообщает администраторам о результате перечитывания конфигурации
+func (h *Handlers) NotifyReload(r configs.Reload) {
+	lang := i18n.Fallback
+	var text string
+	switch {
+	case len(r.Rejected) > 0:
+		text = i18n.T(lang, "config.rejected", "keys", strings.Join(r.Rejected, ", "))
+	case r.Err != nil:
+		text = i18n.T(lang, "config.invalid", "error", redact.String(r.Err.Error()))
+	default:
+		text = i18n.T(lang, "config.applied", "changes", strings.Join(r.Changes, "\n"))
+	}
+
+	h.admins.Range(func(key, _ any) bool {
+		id := key.(int64)
+		if _, err := h.snd.Send(context.Background(), tele.ChatID(id), text); err != nil {
+			slog.Error("Failed to notify admin about config reload", "user_id", id, "error", err)
+		}
+		return true
+	})
+}
+
+func (h *Handlers) IsAdmin(userId int64) bool {
+	_, ok := h.admins.Load(userId)
+	return ok
+}
+
+// AdminOnly пропускает к обработчику только администраторов,
+// остальные попытки записываются в лог
+func (h *Handlers) AdminOnly(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if c.Sender() == nil || !h.IsAdmin(c.Sender().ID) {
+			var userId int64
+			var userName string
+			if c.Sender() != nil {
+				userId, userName = c.Sender().ID, c.Sender().Username
+			}
+			slog.Warn("Unauthorized admin command", "user_id", userId, "user_name", userName, "command", c.Text())
+			return c.Send(i18n.T(senderLang(c), "admin.only"))
+		}
+		return next(c)
+	}
+}
+
+// SetupAdminHandlers привязывает ввод сообщения рассылки, команды и кнопки
+// администратора привязываются из реестра
+func (h *Handlers) SetupAdminHandlers() {
+	// Ввод сообщения рассылки приходит обычным сообщением, поэтому обработчики
+	// общие для всех, а состояние рассылки есть только у администраторов
+	b := h.s.GetBot()
+	for _, endpoint := range []string{tele.OnText, tele.OnPhoto, tele.OnVideo, tele.OnAnimation, tele.OnDocument} {
+		b.Handle(endpoint, h.HandleBroadcastInput)
+	}
+}
+
+// Сколько тегов показывать в /stats
+const statsTopTags = 10
+
+// HandleStats выводит статистику пользователей, подписок и доставки компактной таблицей
+func (h *Handlers) HandleStats(c tele.Context) error {
+	lang := senderLang(c)
+	stats, err := h.d.Stats(statsTopTags)
+	if err != nil {
+		slog.Error("Ошибка при получении статистики", "user_id", c.Sender().ID, "error", err)
+		return c.Send(i18n.T(lang, "stats.error"))
+	}
+
+	var sb strings.Builder
+	row := func(name string, value int) {
+		fmt.Fprintf(&sb, "%-22s %7d\n", truncate(name, 22), value)
+	}
+
+	row(i18n.T(lang, "stats.users"), stats.TotalUsers)
+	row(i18n.T(lang, "stats.active"), stats.ActiveUsers)
+	row(i18n.T(lang, "stats.blocked"), stats.BlockedUsers)
+
+	sb.WriteString("\n" + i18n.T(lang, "stats.by_lang") + "\n")
+	for _, lang := range sortedKeys(stats.UsersByLang) {
+		row(" "+lang, stats.UsersByLang[lang])
+	}
+
+	sb.WriteString("\n" + i18n.T(lang, "stats.top_tags", "count", statsTopTags) + "\n")
+	for _, tag := range stats.TopTags {
+		name := strconv.Itoa(tag.TagID)
+		if t, ok := h.t.ByID(tag.Lang, tag.TagID); ok {
+			name = t.Value
+		}
+		row(fmt.Sprintf(" %s (%s)", name, tag.Lang), tag.Subscribers)
+	}
+
+	sb.WriteString("\n" + i18n.T(lang, "stats.new_users") + "\n")
+	for _, day := range stats.NewUsers {
+		row(" "+day.Day, day.Count)
+	}
+
+	sb.WriteString("\n")
+	row(i18n.T(lang, "stats.delivered"), stats.Delivered24h)
+	sb.WriteString("\n" + i18n.T(lang, "stats.uptime", "bot", h.s.GetBotName(), "uptime", time.Since(h.started).Round(time.Second)))
+
+	return c.Send("<pre>"+html.EscapeString(sb.String())+"</pre>", tele.ModeHTML)
+}
+
+// truncate обрезает строку до n символов, чтобы не ломать колонки таблицы
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// HandleHealth выводит результат проверок готовности
+func (h *Handlers) HandleHealth(c tele.Context) error {
+	lang := senderLang(c)
+	report := h.hc.Check(context.Background())
+
+	names := make([]string, 0, len(report.Components))
+	for name := range report.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(i18n.T(lang, "health.status", "status", report.Status) + "\n")
+	for _, name := range names {
+		status := report.Components[name]
+		mark := "✅"
+		if status.Status != "ok" {
+			mark = "❌"
+		}
+		fmt.Fprintf(&sb, "%s %s %s\n", mark, name, status.Error)
+	}
+	if report.LastUpdate != nil {
+		sb.WriteString(i18n.T(lang, "health.last_update", "ago", time.Since(*report.LastUpdate).Round(time.Second)) + "\n")
+	}
+	return c.Send(sb.String())
+}
+
+// HandleUser выводит карточку пользователя: /user <id>
+func (h *Handlers) HandleUser(c tele.Context) error {
+	lang := senderLang(c)
+	userId, err := strconv.ParseInt(strings.TrimSpace(c.Message().Payload), 10, 64)
+	if err != nil {
+		return c.Send(i18n.T(lang, "user.usage"))
+	}
+
+	user, err := h.d.GetUser(userId)
+	if err != nil {
+		slog.Error("Ошибка при получении пользователя", "user_id", userId, "error", err)
+		return c.Send(i18n.T(lang, "user.error"))
+	}
+	if user == nil {
+		return c.Send(i18n.T(lang, "user.not_found"))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>%d</b> @%s\n", user.ID, html.EscapeString(user.UserName))
+	sb.WriteString(i18n.T(lang, "user.name", "first", html.EscapeString(user.FirstName), "last", html.EscapeString(user.LastName)) + "\n")
+	sb.WriteString(i18n.T(lang, "user.lang", "lang", user.Lang) + "\n")
+	sb.WriteString(i18n.T(lang, "user.blocked", "blocked", user.Blocked) + "\n")
+	sb.WriteString(i18n.T(lang, "user.created", "created", user.Created) + "\n")
+
+	var categories []string
+	for _, id := range user.Categories {
+		name := strconv.Itoa(id)
+		if tag, ok := h.t.ByID(user.Lang, id); ok {
+			name = tag.Value
+		}
+		categories = append(categories, html.EscapeString(name))
+	}
+	sb.WriteString(i18n.T(lang, "user.categories", "categories", strings.Join(categories, ", ")) + "\n")
+
+	return c.Send(sb.String(), tele.ModeHTML)
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/callback"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/redact"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Шаги диалога рассылки
+const (
+	stepCompose  = "compose"
+	stepAudience = "audience"
+	stepConfirm  = "confirm"
+	stepSending  = "sending"
+)
+
+// Как часто обновлять сообщение о ходе рассылки
+const (
+	progressEvery    = 50
+	progressInterval = 5 * time.Second
+)
+
+// broadcast состояние рассылки одного администратора
+type broadcast struct {
+	mu         sync.Mutex
+	step       string
+	lang       string        // Язык интерфейса администратора
+	msg        *tele.Message // Сообщение, которое будет разослано
+	audience   string        // Описание аудитории для отчета
+	recipients []int64
+}
+
+// HandleBroadcast начинает рассылку. Текст можно передать сразу: /broadcast <текст>.
+// Незавершенный черновик заменяется новым, рассылка в процессе отправки - нет
+func (h *Handlers) HandleBroadcast(c tele.Context) error {
+	adminId := c.Sender().ID
+	bc := &broadcast{step: stepCompose, lang: senderLang(c)}
+	for {
+		prev, loaded := h.broadcasts.LoadOrStore(adminId, bc)
+		if !loaded {
+			break
+		}
+		if prev.(*broadcast).at(stepSending) {
+			return c.Send(i18n.T(bc.lang, "broadcast.sending"))
+		}
+		if h.broadcasts.CompareAndSwap(adminId, prev, bc) {
+			break
+		}
+	}
+
+	if strings.TrimSpace(c.Message().Payload) != "" {
+		msg := *c.Message()
+		msg.Text = c.Message().Payload
+		return h.composeBroadcast(c, bc, &msg)
+	}
+
+	return c.Send(i18n.T(bc.lang, "broadcast.compose"))
+}
+
+// HandleBroadcastInput принимает сообщение рассылки от администратора
+func (h *Handlers) HandleBroadcastInput(c tele.Context) error {
+	if c.Sender() == nil || !h.IsAdmin(c.Sender().ID) {
+		return nil
+	}
+	bc, ok := h.broadcast(c.Sender().ID)
+	if !ok {
+		return nil
+	}
+
+	if !bc.at(stepCompose) {
+		return nil
+	}
+
+	return h.composeBroadcast(c, bc, c.Message())
+}
+
+// composeBroadcast показывает предпросмотр сообщения и предлагает выбрать аудиторию
+func (h *Handlers) composeBroadcast(c tele.Context, bc *broadcast, msg *tele.Message) error {
+	if _, err := c.Bot().Send(c.Recipient(), broadcastContent(msg), tele.ModeHTML); err != nil {
+		// Ошибка разметки помогает исправить сообщение, но сетевая ошибка содержит URL с токеном
+		slog.Warn("Broadcast preview failed", "user_id", c.Sender().ID, "error", err)
+		return c.Send(i18n.T(bc.lang, "broadcast.preview_error", "error", redact.String(err.Error())))
+	}
+
+	bc.mu.Lock()
+	bc.msg = msg
+	bc.step = stepAudience
+	bc.mu.Unlock()
+
+	markup := &tele.ReplyMarkup{}
+	rows := []tele.Row{markup.Row(h.button(c, i18n.T(bc.lang, "broadcast.all"), callback.Data{Action: actBroadcastAll}))}
+	for _, lang := range i18n.Langs() {
+		rows = append(rows, markup.Row(
+			h.button(c, i18n.T(bc.lang, "broadcast.lang", "lang", lang), callback.Data{Action: actBroadcastLang, Arg: lang}),
+			h.button(c, i18n.T(bc.lang, "broadcast.by_tag", "lang", lang), callback.Data{Action: actBroadcastTags, Arg: lang}),
+		))
+	}
+	rows = append(rows, markup.Row(h.button(c, i18n.T(bc.lang, "broadcast.cancel"), callback.Data{Action: actBroadcastCancel})))
+	markup.Inline(rows...)
+
+	return c.Send(i18n.T(bc.lang, "broadcast.choose_audience"), markup)
+}
+
+// HandleBroadcastAudience обрабатывает выбор аудитории: все, язык или список тегов языка
+func (h *Handlers) HandleBroadcastAudience(c tele.Context, d callback.Data) error {
+	_ = c.Respond()
+	bc, ok := h.broadcastAt(c, stepAudience)
+	if !ok {
+		return c.Send(i18n.T(senderLang(c), "broadcast.not_found"))
+	}
+
+	lang := d.Arg
+	switch d.Action {
+	case actBroadcastAll:
+		users, err := h.d.GetUsers("")
+		return h.confirmBroadcast(c, bc, i18n.T(bc.lang, "broadcast.audience_all"), users, err)
+	case actBroadcastLang:
+		users, err := h.d.GetUsers(lang)
+		return h.confirmBroadcast(c, bc, i18n.T(bc.lang, "broadcast.audience_lang", "lang", lang), users, err)
+	case actBroadcastTags:
+		markup := &tele.ReplyMarkup{}
+		var rows []tele.Row
+		for _, tag := range h.t.Tags(lang) {
+			data := callback.Data{Action: actBroadcastTag, ID: int64(tag.ID), Arg: lang}
+			rows = append(rows, markup.Row(h.button(c, tag.Value, data)))
+		}
+		rows = append(rows, markup.Row(h.button(c, i18n.T(bc.lang, "broadcast.cancel"), callback.Data{Action: actBroadcastCancel})))
+		markup.Inline(rows...)
+		return c.Edit(i18n.T(bc.lang, "broadcast.choose_tag"), markup)
+	}
+
+	return nil
+}
+
+// HandleBroadcastTag обрабатывает выбор тега, в данных кнопки ID тега и язык
+func (h *Handlers) HandleBroadcastTag(c tele.Context, d callback.Data) error {
+	_ = c.Respond()
+	bc, ok := h.broadcastAt(c, stepAudience)
+	if !ok {
+		return c.Send(i18n.T(senderLang(c), "broadcast.not_found"))
+	}
+
+	lang, tagId := d.Arg, strconv.FormatInt(d.ID, 10)
+	subscribers, err := h.d.GetSubscribers(tagId, lang)
+	users := make([]int64, len(subscribers))
+	for i, id := range subscribers {
+		users[i] = int64(id)
+	}
+
+	name := tagId
+	if tag, found := h.t.ByID(lang, int(d.ID)); found {
+		name = tag.Value
+	}
+	return h.confirmBroadcast(c, bc, i18n.T(bc.lang, "broadcast.audience_tag", "tag", name, "lang", lang), users, err)
+}
+
+// confirmBroadcast показывает число получателей и запрашивает подтверждение
+func (h *Handlers) confirmBroadcast(c tele.Context, bc *broadcast, audience string, users []int64, err error) error {
+	if err != nil {
+		slog.Error("Ошибка при получении аудитории рассылки", "user_id", c.Sender().ID, "audience", audience, "error", err)
+		return c.Send(i18n.T(bc.lang, "broadcast.recipients_error"))
+	}
+	if len(users) == 0 {
+		return c.Edit(i18n.T(bc.lang, "broadcast.empty", "audience", audience))
+	}
+
+	bc.mu.Lock()
+	bc.audience = audience
+	bc.recipients = users
+	bc.step = stepConfirm
+	bc.mu.Unlock()
+
+	markup := &tele.ReplyMarkup{}
+	markup.Inline(markup.Row(
+		h.button(c, i18n.T(bc.lang, "broadcast.send"), callback.Data{Action: actBroadcastConfirm}),
+		h.button(c, i18n.T(bc.lang, "broadcast.cancel"), callback.Data{Action: actBroadcastCancel}),
+	))
+	return c.Edit(i18n.T(bc.lang, "broadcast.confirm", "audience", audience, "count", len(users)), markup)
+}
+
+// HandleBroadcastConfirm запускает доставку рассылки
+func (h *Handlers) HandleBroadcastConfirm(c tele.Context, _ callback.Data) error {
+	_ = c.Respond()
+	// Проверка и смена шага под одной блокировкой: повторное нажатие "Отправить"
+	// не должно запустить вторую доставку
+	bc, ok := h.broadcast(c.Sender().ID)
+	if !ok || !bc.advance(stepConfirm, stepSending) {
+		return c.Send(i18n.T(senderLang(c), "broadcast.not_found"))
+	}
+
+	if err := c.Edit(i18n.T(bc.lang, "broadcast.started", "count", len(bc.recipients))); err != nil {
+		return err
+	}
+
+	adminId := c.Sender().ID
+	go func() {
+		// Удаляется только своя рассылка: запись могла смениться, пока шла доставка
+		defer h.broadcasts.CompareAndDelete(adminId, bc)
+		h.deliverBroadcast(h.s.GetBot(), adminId, bc)
+	}()
+
+	return nil
+}
+
+// HandleBroadcastCancel отменяет незавершенную рассылку
+func (h *Handlers) HandleBroadcastCancel(c tele.Context) error {
+	if c.Callback() != nil {
+		_ = c.Respond()
+	}
+
+	bc, ok := h.broadcast(c.Sender().ID)
+	if ok {
+		if bc.at(stepSending) {
+			return c.Send(i18n.T(senderLang(c), "broadcast.sending"))
+		}
+		h.broadcasts.CompareAndDelete(c.Sender().ID, bc)
+	}
+
+	return c.Send(i18n.T(senderLang(c), "broadcast.cancelled"))
+}
+
+// deliverBroadcast отправляет рассылку через ограничитель скорости,
+// периодически обновляет сообщение о ходе и в конце присылает отчет
+func (h *Handlers) deliverBroadcast(b *tele.Bot, adminId int64, bc *broadcast) {
+	admin := tele.ChatID(adminId)
+	total := len(bc.recipients)
+	content := broadcastContent(bc.msg)
+	start := time.Now()
+
+	status, err := b.Send(admin, i18n.T(bc.lang, "broadcast.progress", "done", 0, "total", total))
+	if err != nil {
+		slog.Error("Ошибка при отправке статуса рассылки", "user_id", adminId, "error", err)
+	}
+
+	slog.Info("Broadcast started", "user_id", adminId, "audience", bc.audience, "recipients", total)
+
+	var sent, blocked, failed int
+	lastUpdate := time.Now()
+	for i, userId := range bc.recipients {
+		_, err := h.snd.Send(context.Background(), tele.ChatID(userId), content, tele.ModeHTML)
+		switch {
+		case err == nil:
+			sent++
+		case errors.Is(err, tele.ErrBlockedByUser), errors.Is(err, tele.ErrUserIsDeactivated):
+			blocked++
+			if err := h.d.SetBlocked(userId, true); err != nil {
+				slog.Error("Ошибка при отметке заблокировавшего пользователя", "user_id", userId, "error", err)
+			}
+		default:
+			failed++
+			slog.Warn("Broadcast send failed", "chat_id", userId, "error", err)
+			h.a.Report("telegram", err, "chat_id", userId, "kind", "broadcast")
+		}
+
+		done := i + 1
+		if status != nil && done < total && (done%progressEvery == 0 || time.Since(lastUpdate) > progressInterval) {
+			lastUpdate = time.Now()
+			_, _ = b.Edit(status, i18n.T(bc.lang, "broadcast.progress", "done", done, "total", total))
+		}
+	}
+
+	if err := h.d.LogDeliveries("broadcast", sent); err != nil {
+		slog.Error("Ошибка при учете доставленных сообщений", "user_id", adminId, "error", err)
+	}
+
+	slog.Info("Broadcast finished", "user_id", adminId, "audience", bc.audience,
+		"sent", sent, "blocked", blocked, "failed", failed)
+
+	report := i18n.T(bc.lang, "broadcast.report", "duration", time.Since(start).Round(time.Second),
+		"audience", bc.audience, "sent", sent, "blocked", blocked, "failed", failed)
+	if status != nil {
+		_, _ = b.Edit(status, report)
+		return
+	}
+	_, _ = b.Send(admin, report)
+}
+
+// advance переводит рассылку с шага from на шаг to, если она на шаге from
+func (bc *broadcast) advance(from, to string) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.step != from {
+		return false
+	}
+	bc.step = to
+	return true
+}
+
+// at сообщает, находится ли рассылка на шаге step
+func (bc *broadcast) at(step string) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.step == step
+}
+
+func (h *Handlers) broadcast(adminId int64) (*broadcast, bool) {
+	value, ok := h.broadcasts.Load(adminId)
+	if !ok {
+		return nil, false
+	}
+	return value.(*broadcast), true
+}
+
+// broadcastAt возвращает рассылку администратора, если она на ожидаемом шаге
+func (h *Handlers) broadcastAt(c tele.Context, step string) (*broadcast, bool) {
+	bc, ok := h.broadcast(c.Sender().ID)
+	if !ok {
+		return nil, false
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc, bc.step == step
+}
+
+// broadcastContent собирает отправляемое содержимое из сообщения администратора
+func broadcastContent(m *tele.Message) interface{} {
+	switch {
+	case m.Photo != nil:
+		photo := *m.Photo
+		photo.Caption = m.Caption
+		return &photo
+	case m.Video != nil:
+		video := *m.Video
+		video.Caption = m.Caption
+		return &video
+	case m.Animation != nil:
+		animation := *m.Animation
+		animation.Caption = m.Caption
+		return &animation
+	case m.Document != nil:
+		document := *m.Document
+		document.Caption = m.Caption
+		return &document
+	default:
+		return m.Text
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+	"strings"
+)
+
+// command декларативное описание команды бота: по нему привязывается обработчик
+// и строится меню команд Telegram
+type command struct {
+	name        string // Без "/"
+	description string // Ключ описания в каталоге сообщений
+	scope       tele.CommandScopeType
+	handler     tele.HandlerFunc
+	admin       bool // Только для администраторов, в меню чатов администраторов
+	hidden      bool // Не показывать в меню команд
+}
+
+// commands реестр команд бота. Команды с областью all_private_chats относятся к
+// подпискам пользователя и показываются только в личных чатах, default - везде
+func (h *Handlers) commands() []command {
+	private := tele.CommandScopeAllPrivateChats
+	return []command{
+		{name: "start", description: "commands.start", scope: private, handler: h.HandleStart, hidden: true},
+		{name: "subscribe", description: "commands.subscribe", scope: private, handler: h.HandleSubscribe},
+		{name: "unsubscribe", description: "commands.unsubscribe", scope: private, handler: h.HandleUnsubscribe},
+		{name: "mysubs", description: "commands.mysubs", scope: private, handler: h.HandleMySubs},
+		{name: "language", description: "commands.language", scope: private, handler: h.HandleLanguage},
+		{name: "settings", description: "commands.settings", scope: private, handler: h.HandleSettings},
+		{name: "help", description: "commands.help", scope: tele.CommandScopeDefault, handler: h.HandleHelp},
+
+		{name: "stats", description: "commands.stats", handler: h.HandleStats, admin: true},
+		{name: "health", description: "commands.health", handler: h.HandleHealth, admin: true},
+		{name: "broadcast", description: "commands.broadcast", handler: h.HandleBroadcast, admin: true},
+		{name: "cancel", description: "commands.cancel", handler: h.HandleBroadcastCancel, admin: true},
+		{name: "user", description: "commands.user", handler: h.HandleUser, admin: true},
+		{name: "tags", description: "commands.tags", handler: h.HandleTags, admin: true},
+		{name: "tag_add", description: "commands.tag_add", handler: h.HandleTagAdd, admin: true},
+		{name: "tag_rename", description: "commands.tag_rename", handler: h.HandleTagRename, admin: true},
+		{name: "tag_translate", description: "commands.tag_translate", handler: h.HandleTagTranslate, admin: true},
+		{name: "tag_on", description: "commands.tag_on", handler: h.HandleTagActive(true), admin: true},
+		{name: "tag_off", description: "commands.tag_off", handler: h.HandleTagActive(false), admin: true},
+		{name: "tag_move", description: "commands.tag_move", handler: h.HandleTagMove, admin: true},
+	}
+}
+
+// bindCommands привязывает обработчики команд из реестра,
+// команды администратора проходят через AdminOnly
+func (h *Handlers) bindCommands() {
+	b := h.s.GetBot()
+	admin := b.Group()
+	admin.Use(h.AdminOnly)
+
+	for _, cmd := range h.commands() {
+		handler := h.featureGate(cmd.name, cmd.handler)
+		if cmd.admin {
+			admin.Handle("/"+cmd.name, handler)
+			continue
+		}
+		b.Handle("/"+cmd.name, handler)
+	}
+}
+
+// featureGate отвечает вместо обработчика, если команда отключена флагом features
+// с ее именем. Флаги проверяются при каждом вызове и меняются без перезапуска
+func (h *Handlers) featureGate(name string, next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if !h.f.Enabled(name) {
+			return c.Send(i18n.T(senderLang(c), "common.disabled"))
+		}
+		return next(c)
+	}
+}
+
+func (h *Handlers) isCommand(name string) bool {
+	for _, cmd := range h.commands() {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// menuCommands команды для меню Telegram на языке lang: для области default только
+// общие команды, для личных чатов еще и команды подписки, для администраторов все
+func (h *Handlers) menuCommands(lang string, scope tele.CommandScopeType, admin bool) []tele.Command {
+	var list []tele.Command
+	for _, cmd := range h.commands() {
+		if cmd.hidden || (cmd.admin && !admin) || !h.f.Enabled(cmd.name) {
+			continue
+		}
+		if !cmd.admin && scope == tele.CommandScopeDefault && cmd.scope != tele.CommandScopeDefault {
+			continue
+		}
+		list = append(list, tele.Command{Text: cmd.name, Description: i18n.T(lang, cmd.description)})
+	}
+	return list
+}
+
+// RegisterCommands публикует меню команд через setMyCommands: для каждого языка каталога
+// и по умолчанию, а в чатах администраторов дополнительно команды администратора
+func (h *Handlers) RegisterCommands() error {
+	b := h.s.GetBot()
+
+	var admins []int64
+	h.admins.Range(func(key, _ any) bool {
+		admins = append(admins, key.(int64))
+		return true
+	})
+
+	var errs []error
+	set := func(lang string, scope tele.CommandScope, admin bool) {
+		ui := lang
+		if ui == "" {
+			ui = i18n.Fallback
+		}
+		if err := b.SetCommands(h.menuCommands(ui, scope.Type, admin), scope, lang); err != nil {
+			errs = append(errs, fmt.Errorf("setMyCommands %s %d %q: %w", scope.Type, scope.ChatID, lang, err))
+		}
+	}
+
+	// Пустой язык - меню для пользователей, для языка которых нет каталога
+	for _, lang := range append(i18n.Langs(), "") {
+		set(lang, tele.CommandScope{Type: tele.CommandScopeDefault}, false)
+		set(lang, tele.CommandScope{Type: tele.CommandScopeAllPrivateChats}, false)
+		for _, id := range admins {
+			set(lang, tele.CommandScope{Type: tele.CommandScopeChat, ChatID: id}, true)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("Bot commands registered", "langs", i18n.Langs(), "admins", len(admins))
+	return nil
+}
+
+// deleteAdminCommands удаляет меню команд в чатах бывших администраторов для всех
+// языков, после этого в их чатах действует меню личных чатов
+func (h *Handlers) deleteAdminCommands(ids []int64) {
+	b := h.s.GetBot()
+	for _, id := range ids {
+		scope := tele.CommandScope{Type: tele.CommandScopeChat, ChatID: id}
+		for _, lang := range append(i18n.Langs(), "") {
+			if err := b.DeleteCommands(scope, lang); err != nil {
+				slog.Error("Ошибка при удалении меню команд администратора", "user_id", id, "lang", lang, "error", err)
+			}
+		}
+	}
+	slog.Info("Admin commands deleted", "admins", len(ids))
+}
+
+// RefreshCommands публикует меню команд заново, если бот уже запущен:
+// после смены администраторов или флагов features
+func (h *Handlers) RefreshCommands() {
+	select {
+	case <-h.s.GetBotReady():
+		go func() {
+			if err := h.RegisterCommands(); err != nil {
+				slog.Error("Ошибка при регистрации меню команд", "error", err)
+			}
+		}()
+	default:
+	}
+}
+
+// HandleHelp выводит список команд из реестра: /help
+func (h *Handlers) HandleHelp(c tele.Context) error {
+	lang := senderLang(c)
+
+	var sb strings.Builder
+	sb.WriteString(i18n.T(lang, "help.title") + "\n")
+	for _, cmd := range h.menuCommands(lang, tele.CommandScopeAllPrivateChats, false) {
+		fmt.Fprintf(&sb, "/%s - %s\n", cmd.Text, cmd.Description)
+	}
+
+	if h.IsAdmin(c.Sender().ID) {
+		sb.WriteString("\n" + i18n.T(lang, "help.admin") + "\n")
+		for _, cmd := range h.commands() {
+			if cmd.admin && h.f.Enabled(cmd.name) {
+				fmt.Fprintf(&sb, "/%s - %s\n", cmd.name, i18n.T(lang, cmd.description))
+			}
+		}
+	}
+
+	return c.Send(sb.String())
+}
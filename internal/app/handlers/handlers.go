@@ -1,12 +1,21 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	tele "gopkg.in/telebot.v4"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/callback"
 	"ibTgBot/internal/app/db"
-	"log"
-	"strconv"
+	"ibTgBot/internal/app/health"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -16,19 +25,22 @@ var (
 
 	//btnYes = menu.Data("Да", "yes")
 	//btnNo  = menu.Data("Нет", "no")
-	// массив состояний кнопок
-	buttonStates = make(map[int]string) // Используем карту для хранения состояния кнопок
-	limit        = 99
 )
 
 type Handlers struct {
-	s             Service
-	d             DB
-	userId        int64
-	langSelected  string
-	userUserName  string
-	userFirstName string
-	userLastName  string
+	s          Service
+	d          DB
+	t          Tags
+	hc         Health
+	snd        Sender
+	a          Alerts
+	f          Features
+	broadcasts sync.Map     // Незавершенные рассылки по ID администратора
+	admins     sync.Map     // Telegram ID администраторов
+	limiters   sync.Map     // *userLimiter по ID пользователя
+	pruned     atomic.Int64 // Время последней очистки limiters, UnixNano
+	codec      *callback.Codec
+	started    time.Time
 }
 
 type Service interface {
@@ -39,13 +51,54 @@ type Service interface {
 }
 
 type DB interface {
-	ReadTags(limit int, active bool, lang string) ([]db.Tag, error)
+	ReadTags(limit int, mainTag bool, lang string) ([]db.Tag, error)
+	CreateTag(lang, value string) (int, error)
+	SetTagValue(tagId int, lang, value string) error
+	SetTagActive(tagId int, active bool) error
+	MoveTag(tagId, position int) error
 	CreateUser(userId int64, userName, firstName, lastName, lang string) error
+	SetUserLang(userId int64, lang string) error
+	SetReferrer(userId, referrerId int64) error
 	ManageCategories(userId int64, tagId *int) (string, error)
+	SetCategories(userId int64, tagIds []int) error
+	GetUser(userId int64) (*db.User, error)
+	GetUsers(lang string) ([]int64, error)
+	GetSubscribers(tagId, lang string) ([]int, error)
+	Stats(topN int) (*db.Stats, error)
+	SetBlocked(userId int64, blocked bool) error
+	LogDeliveries(kind string, count int) error
 }
 
-func New(s Service, d DB) *Handlers {
-	return &Handlers{s: s, d: d, langSelected: "ru"}
+type Tags interface {
+	Tags(lang string) []db.Tag
+	ByID(lang string, id int) (db.Tag, bool)
+	Main(lang string) []db.Tag
+	Children(lang string, parent int) []db.Tag
+	Changed(lang string) error
+}
+
+type Health interface {
+	Check(ctx context.Context) health.Report
+}
+
+type Sender interface {
+	Send(ctx context.Context, to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error)
+}
+
+type Alerts interface {
+	Report(source string, err error, attrs ...any)
+}
+
+type Features interface {
+	Enabled(name string) bool
+}
+
+func New(conf *configs.Conf, s Service, d DB, t Tags, hc Health, snd Sender, a Alerts, f Features) *Handlers {
+	// Ключ подписи кнопок выводится из токена, поэтому одинаков у всех реплик
+	key := sha256.Sum256([]byte("callback|" + conf.GetTG().Token))
+	h := &Handlers{s: s, d: d, t: t, hc: hc, snd: snd, a: a, f: f, codec: callback.New(key[:]), started: time.Now()}
+	h.SetAdmins(conf.GetTG().Admins)
+	return h
 }
 
 func (h *Handlers) Run() error {
@@ -60,162 +113,225 @@ func (h *Handlers) Run() error {
 func (h *Handlers) SetupHandlers() {
 	b := h.s.GetBot()
 
-	// Команда /subscribe для отправки меню
-	b.Handle("/subscribe", func(c tele.Context) error {
-		// Автоопределение языка пользователя
-		userLang := c.Sender().LanguageCode
-		userId := c.Sender().ID
-		// Данные пользователя
-		h.userId = userId
-		h.userUserName = c.Sender().Username
-		h.userFirstName = c.Sender().FirstName
-		h.userLastName = c.Sender().LastName
-
-		// Запрос подтверждения у пользователя
-		btnYes := menu.Data("Да", "yes")
-		btnNo := menu.Data("Нет", "no")
-		menu.Inline(
-			menu.Row(btnYes, btnNo),
-		)
-		msg, err := b.Send(tele.ChatID(userId), fmt.Sprintf("Язык определен как '%s'. Продолжить?", userLang), menu)
-		if err != nil {
-			return err
-		}
-		// Привязка обработчиков к кнопкам подтверждения и отмены
-		b.Handle(&btnYes, func(c tele.Context) error {
-			h.langSelected = "ru"
-			b.Delete(msg)
-			return h.HandleConfirmation(c, "ru")
-		})
-		b.Handle(&btnNo, func(c tele.Context) error {
-			h.langSelected = "es"
-			b.Delete(msg)
-			return h.HandleConfirmation(c, "es")
-		})
-		return nil
-	})
+	// Middleware применяются к обработчикам, привязанным после вызова Use
+	b.Use(h.middleware()...)
+
+	// Команды из реестра, все нажатия кнопок проходят через один маршрутизатор
+	h.bindCommands()
+	b.Handle(tele.OnCallback, h.HandleCallback)
+	b.Handle(tele.OnMyChatMember, h.HandleMyChatMember)
+
+	h.SetupAdminHandlers()
+
+	if err := h.RegisterCommands(); err != nil {
+		slog.Error("Ошибка при регистрации меню команд", "error", err)
+	}
 
 	// Обработка нажатия кнопки "Подписаться"
 	b.Handle(&btnNext, func(c tele.Context) error {
 		c.Respond()
-		return c.Send("Вы подписаны!")
+		return c.Send(i18n.T(senderLang(c), "subscribe.subscribed"))
 	})
 
 	// Обработка нажатия кнопки "Отписаться"
 	b.Handle(&btnPrev, func(c tele.Context) error {
 		c.Respond()
-		return c.Send("Вы отписаны!")
+		return c.Send(i18n.T(senderLang(c), "subscribe.unsubscribed"))
 	})
 }
 
-func (h *Handlers) HandleConfirmation(c tele.Context, userLang string) error {
-	//Пользователь ответил, создаю пользователя в БД
-	err := h.d.CreateUser(h.userId, h.userUserName, h.userFirstName, h.userLastName, userLang)
-	if err != nil {
-		log.Printf("Ошибка при создании пользователя %e", err)
-	}
-	// Получаем данные из SQLReadTags
-	tags, err := h.d.ReadTags(limit, true, userLang)
-	if err != nil {
-		log.Printf("Ошибка при создании меню тегов %e", err)
-		return c.Send("Ошибка при создании меню тегов")
-	}
+// HandleSubscribe выбор языка, затем меню категорий: /subscribe
+func (h *Handlers) HandleSubscribe(c tele.Context) error {
+	return h.sendLanguagePicker(c, langFromSubscribe)
+}
 
-	// Инициализация состояния кнопок на основе полученных данных
-	for _, tag := range tags {
-		buttonStates[tag.ID] = "0" // Все кнопки неактивны по умолчанию
+// HandleUnsubscribe открывает меню категорий на языке пользователя, где
+// отмеченные категории снимаются нажатием: /unsubscribe
+func (h *Handlers) HandleUnsubscribe(c tele.Context) error {
+	return h.HandleConfirmation(c, senderLang(c))
+}
+
+func (h *Handlers) HandleConfirmation(c tele.Context, userLang string) error {
+	// Пользователь создан при выборе языка, теги берутся из каталога
+	if len(h.t.Tags(userLang)) == 0 {
+		slog.Error("Каталог тегов пуст", "user_id", c.Sender().ID, "lang", userLang)
+		return c.Send(i18n.T(userLang, "subscribe.menu_error"))
 	}
 
-	// Создание меню на основе состояний кнопок
-	h.CreateButtons(tags)
 	// Отправка меню с кнопками
-	return c.Send("Выберите опцию:", menu)
+	return c.Send(i18n.T(userLang, "subscribe.choose"), h.CreateButtons(c.Sender().ID, userLang, 0))
 }
 
-func (h *Handlers) CreateButtons(tags []db.Tag) {
-	var buttons []tele.Row
-	userCats, err := h.d.ManageCategories(h.userId, nil)
+// CreateButtons собирает меню категорий: основные теги без подтегов идут в две колонки,
+// тег с подтегами занимает строку с кнопкой раскрытия группы. Раскрыта только группа
+// expanded, подписки пользователя отмечены, внизу кнопки "Выбрать все", "Снять все" и "Готово"
+func (h *Handlers) CreateButtons(userId int64, lang string, expanded int) *tele.ReplyMarkup {
+	menu := &tele.ReplyMarkup{}
+	subs, err := h.subscriptions(userId)
 	if err != nil {
-		log.Printf("Ошибка при получении категорий пользователя: %e", err)
+		slog.Error("Ошибка при получении категорий пользователя", "user_id", userId, "error", err)
 	}
 
-	var userCatsSet []int
-	// Заполнение слайса id категорий пользователя для быстрой проверки
-	err = json.Unmarshal([]byte(userCats), &userCatsSet)
-	if err != nil {
-		log.Printf("Ошибка при парсинге категорий пользователя: %e", err)
+	selected := make(map[int]bool, len(subs))
+	for _, id := range subs {
+		selected[id] = true
 	}
 
-	// Обновляем buttonStates
-	buttonStates := make(map[int]string)
-	for _, cat := range userCatsSet {
-		buttonStates[cat] = "1"
+	encode := func(d callback.Data) string {
+		return h.codec.Encode(userId, d)
 	}
-
-	for i := 0; i < len(tags); i += 2 {
-		btn1ID := tags[i].ID
-		log.Printf("TagId: %d", btn1ID)
-		btn1Text := "❌ " + tags[i].Value
-
-		// Если btn1ID находится в категориях пользователя, то помечаем кнопку как активную
-		if buttonStates[btn1ID] == "1" {
-			btn1Text = "✅ " + tags[i].Value
-		} else {
-			buttonStates[btn1ID] = "0"
+	button := func(tag db.Tag, indent string) tele.Btn {
+		text := indent + "❌ " + tag.Value
+		// Если тег находится в категориях пользователя, то помечаем кнопку как активную
+		if selected[tag.ID] {
+			text = indent + "✅ " + tag.Value
 		}
+		return tele.Btn{Text: text, Data: encode(callback.Data{Action: actCategory, Page: expanded, ID: int64(tag.ID)})}
+	}
 
-		btn1 := menu.Data(btn1Text, "btn_"+strconv.Itoa(btn1ID), strconv.Itoa(btn1ID))
-
-		var btn2 tele.Btn
-		var btn2ID int
-		if i+1 < len(tags) {
-			btn2ID = tags[i+1].ID
-			btn2Text := "❌ " + tags[i+1].Value
+	var rows []tele.Row
+	var pair []tele.Btn
+	flush := func() {
+		if len(pair) > 0 {
+			rows = append(rows, menu.Row(pair...))
+			pair = nil
+		}
+	}
 
-			if buttonStates[btn2ID] == "1" {
-				btn2Text = "✅ " + tags[i+1].Value
-			} else {
-				buttonStates[btn2ID] = "0"
+	for _, tag := range h.t.Main(lang) {
+		children := h.t.Children(lang, tag.ID)
+		if len(children) == 0 {
+			if pair = append(pair, button(tag, "")); len(pair) == 2 {
+				flush()
 			}
+			continue
+		}
+		flush()
 
-			btn2 = menu.Data(btn2Text, "btn_"+strconv.Itoa(btn2ID), strconv.Itoa(btn2ID))
-			buttons = append(buttons, menu.Row(btn1, btn2))
-		} else {
-			buttons = append(buttons, menu.Row(btn1))
+		// Кнопка группы показывает, сколько подтегов отмечено
+		var count int
+		for _, child := range children {
+			if selected[child.ID] {
+				count++
+			}
+		}
+		arrow, group := "▸", tag.ID
+		if tag.ID == expanded {
+			arrow, group = "▾", 0
 		}
+		toggle := tele.Btn{
+			Text: fmt.Sprintf("%s %d/%d", arrow, count, len(children)),
+			Data: encode(callback.Data{Action: actCategoryGroup, ID: int64(group)}),
+		}
+		rows = append(rows, menu.Row(button(tag, ""), toggle))
 
-		h.AddButtonHandler(btn1, btn1ID)
-		if i+1 < len(tags) {
-			h.AddButtonHandler(btn2, btn2ID)
+		if tag.ID != expanded {
+			continue
+		}
+		for i := 0; i < len(children); i += 2 {
+			row := []tele.Btn{button(children[i], "↳ ")}
+			if i+1 < len(children) {
+				row = append(row, button(children[i+1], "↳ "))
+			}
+			rows = append(rows, menu.Row(row...))
 		}
 	}
+	flush()
+
+	rows = append(rows,
+		menu.Row(
+			tele.Btn{Text: i18n.T(lang, "subscribe.select_all"), Data: encode(callback.Data{Action: actCategoryAll, Page: expanded})},
+			tele.Btn{Text: i18n.T(lang, "subscribe.clear_all"), Data: encode(callback.Data{Action: actCategoryClear, Page: expanded})},
+		),
+		menu.Row(tele.Btn{Text: i18n.T(lang, "subscribe.done"), Data: encode(callback.Data{Action: actCategoryDone})}),
+	)
+
+	menu.Inline(rows...)
+	return menu
+}
+
+// HandleCategoryToggle переключает подписку на категорию из данных кнопки и обновляет меню
+func (h *Handlers) HandleCategoryToggle(c tele.Context, d callback.Data) error {
+	userId := c.Sender().ID
+	id := int(d.ID)
 
-	menu.Inline(buttons...)
+	// Ошибку сообщают пользователю и администраторам middleware Recover
+	if _, err := h.d.ManageCategories(userId, &id); err != nil {
+		return fmt.Errorf("ManageCategories user %d tag %d: %w", userId, id, err)
+	}
+
+	return h.editCategories(c, d.Page)
 }
 
-func (h *Handlers) AddButtonHandler(btn tele.Btn, id int) {
-	h.s.GetBot().Handle(&btn, func(c tele.Context) error {
-		// Обновление состояния кнопки
-		switch buttonStates[id] {
-		case "0":
-			buttonStates[id] = "1"
-		case "1":
-			buttonStates[id] = "0"
-		}
+// HandleCategoryGroup раскрывает группу подтегов из данных кнопки, ID 0 сворачивает группу
+func (h *Handlers) HandleCategoryGroup(c tele.Context, d callback.Data) error {
+	return h.editCategories(c, int(d.ID))
+}
 
-		_, err := h.d.ManageCategories(h.userId, &id)
-		if err != nil {
-			log.Fatalf("Ошибка при обновлении категорий пользователя %e", err)
-		}
+// HandleCategoryAll подписывает на все категории каталога. Подписки на теги,
+// которых нет в каталоге языка, сохраняются
+func (h *Handlers) HandleCategoryAll(c tele.Context, d callback.Data) error {
+	userId := c.Sender().ID
 
-		// Пересоздание всех кнопок с обновленными значениями
-		tags, err := h.d.ReadTags(limit, true, h.langSelected)
-		if err != nil {
-			return c.Send("Ошибка обновления меню тагов")
+	subs, err := h.subscriptions(userId)
+	if err != nil {
+		return fmt.Errorf("subscriptions user %d: %w", userId, err)
+	}
+	for _, tag := range h.t.Tags(senderLang(c)) {
+		if !slices.Contains(subs, tag.ID) {
+			subs = append(subs, tag.ID)
 		}
+	}
 
-		h.CreateButtons(tags)
-		c.Respond()
-		return c.EditOrReply(menu)
-	})
+	if err := h.d.SetCategories(userId, subs); err != nil {
+		return fmt.Errorf("SetCategories user %d: %w", userId, err)
+	}
+	slog.Info("User subscribed to all", "user_id", userId, "count", len(subs))
+
+	return h.editCategories(c, d.Page)
+}
+
+// HandleCategoryClear отписывает от всех категорий
+func (h *Handlers) HandleCategoryClear(c tele.Context, d callback.Data) error {
+	userId := c.Sender().ID
+
+	if err := h.d.SetCategories(userId, []int{}); err != nil {
+		return fmt.Errorf("SetCategories user %d: %w", userId, err)
+	}
+	slog.Info("User unsubscribed from all", "user_id", userId)
+
+	return h.editCategories(c, d.Page)
+}
+
+// HandleCategoryDone убирает меню категорий и показывает число подписок
+func (h *Handlers) HandleCategoryDone(c tele.Context, _ callback.Data) error {
+	userId := c.Sender().ID
+	lang := senderLang(c)
+
+	subs, err := h.subscriptions(userId)
+	if err != nil {
+		return fmt.Errorf("subscriptions user %d: %w", userId, err)
+	}
+
+	_ = c.Respond()
+	if len(subs) == 0 {
+		return c.Edit(i18n.T(lang, "subscribe.done_empty"))
+	}
+	return c.Edit(i18n.T(lang, "subscribe.done_summary", "count", len(subs)))
+}
+
+// editCategories перерисовывает меню категорий в том же сообщении
+func (h *Handlers) editCategories(c tele.Context, expanded int) error {
+	lang := senderLang(c)
+	if len(h.t.Tags(lang)) == 0 {
+		return c.Send(i18n.T(lang, "subscribe.update_error"))
+	}
+
+	_ = c.Respond()
+	err := c.EditOrReply(h.CreateButtons(c.Sender().ID, lang, expanded))
+	// Нажатие не изменило меню, например "Снять все" без подписок
+	if errors.Is(err, tele.ErrSameMessageContent) || errors.Is(err, tele.ErrMessageNotModified) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/callback"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+)
+
+// Откуда открыт выбор языка, от этого зависит действие кнопки
+const (
+	langFromSubscribe = actLanguageSubscribe
+	langFromCommand   = actLanguage
+)
+
+// HandleLanguage меняет язык пользователя: /language
+func (h *Handlers) HandleLanguage(c tele.Context) error {
+	return h.sendLanguagePicker(c, langFromCommand)
+}
+
+// sendLanguagePicker предлагает все языки бота, текущий язык пользователя отмечен
+func (h *Handlers) sendLanguagePicker(c tele.Context, from string) error {
+	current := senderLang(c)
+
+	markup := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, lang := range i18n.Langs() {
+		name := i18n.T(lang, "language.name")
+		if lang == current {
+			name = "✅ " + name
+		}
+		rows = append(rows, markup.Row(h.button(c, name, callback.Data{Action: from, Arg: lang})))
+	}
+	markup.Inline(rows...)
+
+	return c.Send(i18n.T(current, "language.choose"), markup)
+}
+
+// HandleLanguageSelect сохраняет выбранный язык. После /subscribe продолжает выбором категорий
+func (h *Handlers) HandleLanguageSelect(c tele.Context, d callback.Data) error {
+	from, lang := d.Action, d.Arg
+	if !isLang(lang) {
+		return c.Respond()
+	}
+
+	if err := h.saveLang(c.Sender(), lang); err != nil {
+		slog.Error("Ошибка при сохранении языка пользователя", "user_id", c.Sender().ID, "lang", lang, "error", err)
+		return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "language.error")})
+	}
+	slog.Info("User language selected", "user_id", c.Sender().ID, "lang", lang)
+
+	_ = c.Respond()
+	_ = c.Delete()
+
+	if from == langFromSubscribe {
+		return h.HandleConfirmation(c, lang)
+	}
+	return c.Send(i18n.T(lang, "language.changed", "name", i18n.T(lang, "language.name")))
+}
+
+// saveLang создает пользователя с выбранным языком или меняет язык существующему
+func (h *Handlers) saveLang(sender *tele.User, lang string) error {
+	user, err := h.d.GetUser(sender.ID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return h.d.CreateUser(sender.ID, sender.Username, sender.FirstName, sender.LastName, lang)
+	}
+	if user.Lang == lang {
+		return nil
+	}
+	return h.d.SetUserLang(sender.ID, lang)
+}
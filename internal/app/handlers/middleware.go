@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/db"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/metrics"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Ключи значений в контексте обновления
+const (
+	ctxUser = "user" // *db.User, nil для незарегистрированных
+	ctxLang = "lang" // Язык интерфейса
+)
+
+// Частота обновлений от одного пользователя
+const (
+	userRate  = rate.Limit(1)
+	userBurst = 5
+	// Ограничитель пользователя, который не писал дольше limiterTTL, удаляется:
+	// за это время он все равно полностью восстанавливается
+	limiterTTL = 10 * time.Minute
+)
+
+// userLimiter ограничитель частоты с временем последнего обновления, UnixNano
+type userLimiter struct {
+	*rate.Limiter
+	seen atomic.Int64
+}
+
+// middleware цепочка, через которую проходят все обновления, порядок важен:
+// восстановление после паники, лог, ограничение частоты, загрузка пользователя, язык.
+// Ограничение стоит до загрузки пользователя, чтобы отброшенные обновления не шли в БД
+func (h *Handlers) middleware() []tele.MiddlewareFunc {
+	return []tele.MiddlewareFunc{h.Recover, h.Logging, h.RateLimit, h.LoadUser, h.Localize}
+}
+
+// Recover не дает панике в обработчике остановить бота. О панике и ошибке, которую вернул
+// обработчик, пользователь получает понятное сообщение, а администраторы - отчет с контекстом
+func (h *Handlers) Recover(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Паника в обработчике", "user_id", senderId(c), "update", c.Update().ID,
+					"panic", r, "stack", string(debug.Stack()))
+				err = fmt.Errorf("panic: %v", r)
+			}
+			if err != nil {
+				h.reportError(c, err)
+				err = nil
+			}
+		}()
+		return next(c)
+	}
+}
+
+// reportError отправляет отчет администраторам и извиняется перед пользователем
+func (h *Handlers) reportError(c tele.Context, err error) {
+	attrs := []any{"user_id", senderId(c), "update", c.Update().ID}
+	switch {
+	case c.Callback() != nil:
+		attrs = append(attrs, "callback", c.Callback().Data)
+	case c.Message() != nil:
+		attrs = append(attrs, "text", truncate(c.Message().Text, 100))
+	}
+	h.a.Report("handler", err, attrs...)
+
+	text := i18n.T(senderLang(c), "common.error")
+	if c.Callback() != nil {
+		_ = c.Respond(&tele.CallbackResponse{Text: text, ShowAlert: true})
+		return
+	}
+	if c.Sender() != nil {
+		_ = c.Send(text)
+	}
+}
+
+// Logging пишет в лог каждое обновление с длительностью обработки и учитывает команды в метриках
+func (h *Handlers) Logging(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		attrs := []any{"user_id", senderId(c), "update", c.Update().ID, "duration", time.Since(start)}
+		switch {
+		case c.Callback() != nil:
+			attrs = append(attrs, "callback", c.Callback().Data)
+		case c.Message() != nil && strings.HasPrefix(c.Message().Text, "/"):
+			name := commandName(c.Message().Text)
+			attrs = append(attrs, "command", name)
+			if h.isCommand(name) {
+				metrics.ObserveCommand(name, senderId(c))
+			}
+		}
+
+		if err != nil {
+			slog.Error("Ошибка при обработке обновления", append(attrs, "error", err)...)
+			return err
+		}
+		slog.Debug("Update handled", attrs...)
+		return nil
+	}
+}
+
+// LoadUser загружает пользователя из БД в контекст обновления
+func (h *Handlers) LoadUser(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if c.Sender() == nil {
+			return next(c)
+		}
+
+		user, err := h.d.GetUser(c.Sender().ID)
+		if err != nil {
+			slog.Error("Ошибка при получении пользователя", "user_id", c.Sender().ID, "error", err)
+		}
+		if user != nil {
+			// Пользователь снова пишет боту, значит разблокировал его. Изменение
+			// статуса бота обрабатывает HandleMyChatMember
+			if user.Blocked && c.Update().MyChatMember == nil {
+				if err := h.d.SetBlocked(user.ID, false); err != nil {
+					slog.Error("Ошибка при снятии отметки о блокировке", "user_id", user.ID, "error", err)
+				} else {
+					user.Blocked = false
+					slog.Info("User unblocked the bot", "user_id", user.ID)
+				}
+			}
+			c.Set(ctxUser, user)
+		}
+		return next(c)
+	}
+}
+
+// RateLimit отбрасывает обновления пользователя сверх userRate в секунду
+func (h *Handlers) RateLimit(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if c.Sender() == nil || h.IsAdmin(c.Sender().ID) {
+			return next(c)
+		}
+
+		now := time.Now()
+		h.pruneLimiters(now)
+
+		v, _ := h.limiters.LoadOrStore(c.Sender().ID, &userLimiter{Limiter: rate.NewLimiter(userRate, userBurst)})
+		limiter := v.(*userLimiter)
+		limiter.seen.Store(now.UnixNano())
+		if !limiter.AllowN(now, 1) {
+			slog.Warn("User rate limited", "user_id", c.Sender().ID)
+			if c.Callback() != nil {
+				return c.Respond(&tele.CallbackResponse{Text: i18n.T(i18n.Match(c.Sender().LanguageCode), "common.too_fast")})
+			}
+			return nil
+		}
+		return next(c)
+	}
+}
+
+// pruneLimiters удаляет ограничители неактивных пользователей, не чаще раза в limiterTTL
+func (h *Handlers) pruneLimiters(now time.Time) {
+	last := h.pruned.Load()
+	if now.UnixNano()-last < int64(limiterTTL) || !h.pruned.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	h.limiters.Range(func(id, v any) bool {
+		if now.UnixNano()-v.(*userLimiter).seen.Load() > int64(limiterTTL) {
+			h.limiters.Delete(id)
+		}
+		return true
+	})
+}
+
+// Localize определяет язык интерфейса: сохраненный язык пользователя,
+// для новых пользователей - по language_code из Telegram
+func (h *Handlers) Localize(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		lang := i18n.Fallback
+		if user := contextUser(c); user != nil && isLang(user.Lang) {
+			lang = user.Lang
+		} else if c.Sender() != nil {
+			lang = i18n.Match(c.Sender().LanguageCode)
+		}
+		if !isLang(lang) {
+			lang = i18n.Fallback
+		}
+
+		c.Set(ctxLang, lang)
+		return next(c)
+	}
+}
+
+// contextUser пользователь, загруженный LoadUser
+func contextUser(c tele.Context) *db.User {
+	user, _ := c.Get(ctxUser).(*db.User)
+	return user
+}
+
+// senderLang язык интерфейса для отправителя обновления
+func senderLang(c tele.Context) string {
+	if lang, ok := c.Get(ctxLang).(string); ok {
+		return lang
+	}
+	if c.Sender() == nil {
+		return i18n.Fallback
+	}
+	return i18n.Match(c.Sender().LanguageCode)
+}
+
+func senderId(c tele.Context) int64 {
+	if c.Sender() == nil {
+		return 0
+	}
+	return c.Sender().ID
+}
+
+// commandName имя команды без "/" и имени бота: "/start@bot x" -> "start"
+func commandName(text string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	name, _, _ = strings.Cut(name, "@")
+	return name
+}
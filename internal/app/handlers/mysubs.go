@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"html"
+	"ibTgBot/internal/app/callback"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HandleMySubs выводит подписки пользователя с кнопками отписки: /mysubs
+func (h *Handlers) HandleMySubs(c tele.Context) error {
+	lang := senderLang(c)
+	text, markup, err := h.mySubs(c, lang)
+	if err != nil {
+		slog.Error("Ошибка при получении категорий пользователя", "user_id", c.Sender().ID, "error", err)
+		return c.Send(i18n.T(lang, "mysubs.error"))
+	}
+	return c.Send(text, markup, tele.ModeHTML)
+}
+
+// HandleMySubsRemove отписывает от одной категории и обновляет список
+func (h *Handlers) HandleMySubsRemove(c tele.Context, d callback.Data) error {
+	userId := c.Sender().ID
+	lang := senderLang(c)
+	tagId := int(d.ID)
+
+	subs, err := h.subscriptions(userId)
+	if err != nil {
+		slog.Error("Ошибка при получении категорий пользователя", "user_id", userId, "error", err)
+		return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "mysubs.error")})
+	}
+
+	// ManageCategories переключает подписку, поэтому для устаревшей кнопки не вызывается
+	if slices.Contains(subs, tagId) {
+		if _, err := h.d.ManageCategories(userId, &tagId); err != nil {
+			slog.Error("Ошибка при обновлении категорий пользователя", "user_id", userId, "tag_id", tagId, "error", err)
+			return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "mysubs.error")})
+		}
+		slog.Info("User unsubscribed", "user_id", userId, "tag_id", tagId)
+	}
+
+	name := strconv.Itoa(tagId)
+	if tag, ok := h.t.ByID(lang, tagId); ok {
+		name = tag.Value
+	}
+	_ = c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "mysubs.removed", "tag", name)})
+	return h.editMySubs(c, lang)
+}
+
+// HandleMySubsClear отписывает от всех категорий
+func (h *Handlers) HandleMySubsClear(c tele.Context, _ callback.Data) error {
+	userId := c.Sender().ID
+	lang := senderLang(c)
+
+	if err := h.d.SetCategories(userId, []int{}); err != nil {
+		slog.Error("Ошибка при очистке категорий пользователя", "user_id", userId, "error", err)
+		return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "mysubs.error")})
+	}
+	slog.Info("User unsubscribed from all", "user_id", userId)
+
+	_ = c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "mysubs.cleared")})
+	return h.editMySubs(c, lang)
+}
+
+func (h *Handlers) editMySubs(c tele.Context, lang string) error {
+	text, markup, err := h.mySubs(c, lang)
+	if err != nil {
+		slog.Error("Ошибка при получении категорий пользователя", "user_id", c.Sender().ID, "error", err)
+		return c.Send(i18n.T(lang, "mysubs.error"))
+	}
+	err = c.Edit(text, markup, tele.ModeHTML)
+	// Повторное нажатие, например отписка от уже удаленной категории, не меняет список
+	if errors.Is(err, tele.ErrSameMessageContent) || errors.Is(err, tele.ErrMessageNotModified) {
+		return nil
+	}
+	return err
+}
+
+// mySubs собирает список подписок: по кнопке отписки на категорию, затем
+// кнопки "Добавить" и "Отписаться от всех"
+func (h *Handlers) mySubs(c tele.Context, lang string) (string, *tele.ReplyMarkup, error) {
+	subs, err := h.subscriptions(c.Sender().ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	markup := &tele.ReplyMarkup{}
+	if len(subs) == 0 {
+		markup.Inline(markup.Row(h.button(c, i18n.T(lang, "mysubs.add"), callback.Data{Action: actSubsAdd})))
+		return i18n.T(lang, "mysubs.empty"), markup, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(i18n.T(lang, "mysubs.title", "count", len(subs)) + "\n")
+
+	var rows []tele.Row
+	for _, tagId := range subs {
+		name := strconv.Itoa(tagId)
+		if tag, ok := h.t.ByID(lang, tagId); ok {
+			name = tag.Value
+		}
+		fmt.Fprintf(&sb, "• %s\n", html.EscapeString(name))
+		rows = append(rows, markup.Row(h.button(c, "❌ "+name, callback.Data{Action: actSubsRemove, ID: int64(tagId)})))
+	}
+	rows = append(rows, markup.Row(
+		h.button(c, i18n.T(lang, "mysubs.add"), callback.Data{Action: actSubsAdd}),
+		h.button(c, i18n.T(lang, "mysubs.clear"), callback.Data{Action: actSubsClear}),
+	))
+	markup.Inline(rows...)
+
+	return sb.String(), markup, nil
+}
+
+// subscriptions ID тегов, на которые подписан пользователь
+func (h *Handlers) subscriptions(userId int64) ([]int, error) {
+	categories, err := h.d.ManageCategories(userId, nil)
+	if err != nil {
+		return nil, err
+	}
+	if categories == "" {
+		return nil, nil
+	}
+
+	var subs []int
+	if err := json.Unmarshal([]byte(categories), &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse categories: %w", err)
+	}
+	return subs, nil
+}
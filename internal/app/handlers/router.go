@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/callback"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+)
+
+// Действия кнопок. Коды короткие, чтобы данные помещались в 64 байта,
+// при изменении смысла действия нужно увеличить callback.Version
+const (
+	actCategory           = "c"  // ID: тег, Page: раскрытая группа
+	actCategoryGroup      = "cg" // ID: группа, 0 сворачивает
+	actCategoryAll        = "ca" // Page: раскрытая группа
+	actCategoryClear      = "cx" // Page: раскрытая группа
+	actCategoryDone       = "cd"
+	actLanguage           = "l"  // Arg: язык
+	actLanguageSubscribe  = "ls" // Arg: язык, затем меню категорий
+	actSettingsLanguage   = "sl"
+	actSettingsCategories = "sc"
+	actSubsRemove         = "md" // ID: тег
+	actSubsAdd            = "ma"
+	actSubsClear          = "mc"
+	actBroadcastAll       = "ba"
+	actBroadcastLang      = "bl" // Arg: язык
+	actBroadcastTags      = "bt" // Arg: язык
+	actBroadcastTag       = "bg" // ID: тег, Arg: язык
+	actBroadcastConfirm   = "bo"
+	actBroadcastCancel    = "bx"
+)
+
+// route обработчик действия кнопки
+type route struct {
+	handler func(c tele.Context, d callback.Data) error
+	admin   bool
+}
+
+func (h *Handlers) routes() map[string]route {
+	return map[string]route{
+		actCategory:           {handler: h.HandleCategoryToggle},
+		actCategoryGroup:      {handler: h.HandleCategoryGroup},
+		actCategoryAll:        {handler: h.HandleCategoryAll},
+		actCategoryClear:      {handler: h.HandleCategoryClear},
+		actCategoryDone:       {handler: h.HandleCategoryDone},
+		actLanguage:           {handler: h.HandleLanguageSelect},
+		actLanguageSubscribe:  {handler: h.HandleLanguageSelect},
+		actSettingsLanguage:   {handler: h.HandleSettingsLanguage},
+		actSettingsCategories: {handler: h.HandleSettingsCategories},
+		actSubsRemove:         {handler: h.HandleMySubsRemove},
+		actSubsAdd:            {handler: h.HandleSettingsCategories},
+		actSubsClear:          {handler: h.HandleMySubsClear},
+
+		actBroadcastAll:     {handler: h.HandleBroadcastAudience, admin: true},
+		actBroadcastLang:    {handler: h.HandleBroadcastAudience, admin: true},
+		actBroadcastTags:    {handler: h.HandleBroadcastAudience, admin: true},
+		actBroadcastTag:     {handler: h.HandleBroadcastTag, admin: true},
+		actBroadcastConfirm: {handler: h.HandleBroadcastConfirm, admin: true},
+		actBroadcastCancel: {handler: func(c tele.Context, _ callback.Data) error {
+			return h.HandleBroadcastCancel(c)
+		}, admin: true},
+	}
+}
+
+// HandleCallback единый маршрутизатор нажатий кнопок. Кнопки старой версии,
+// с измененными данными или нажатые не тем пользователем отклоняются
+func (h *Handlers) HandleCallback(c tele.Context) error {
+	userId := c.Sender().ID
+	lang := senderLang(c)
+
+	d, err := h.codec.Decode(userId, c.Callback().Data)
+	r, ok := h.routes()[d.Action]
+	if err != nil || !ok {
+		if errors.Is(err, callback.ErrSignature) {
+			slog.Warn("Callback signature mismatch", "user_id", userId, "data", c.Callback().Data)
+		} else {
+			slog.Info("Stale callback", "user_id", userId, "data", c.Callback().Data)
+		}
+		return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "common.expired"), ShowAlert: true})
+	}
+
+	if r.admin && !h.IsAdmin(userId) {
+		slog.Warn("Unauthorized admin callback", "user_id", userId, "action", d.Action)
+		return c.Respond(&tele.CallbackResponse{Text: i18n.T(lang, "admin.only")})
+	}
+
+	return r.handler(c, d)
+}
+
+// button кнопка с данными, подписанными для отправителя обновления
+func (h *Handlers) button(c tele.Context, text string, d callback.Data) tele.Btn {
+	return tele.Btn{Text: text, Data: h.codec.Encode(senderId(c), d)}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	tele "gopkg.in/telebot.v4"
+	"ibTgBot/internal/app/callback"
+	"ibTgBot/internal/app/i18n"
+)
+
+// HandleSettings показывает язык и число подписок с кнопками для их изменения: /settings
+func (h *Handlers) HandleSettings(c tele.Context) error {
+	lang := senderLang(c)
+	var subscriptions int
+	if user := contextUser(c); user != nil {
+		subscriptions = len(user.Categories)
+	}
+
+	markup := &tele.ReplyMarkup{}
+	markup.Inline(markup.Row(
+		h.button(c, i18n.T(lang, "settings.language"), callback.Data{Action: actSettingsLanguage}),
+		h.button(c, i18n.T(lang, "settings.categories"), callback.Data{Action: actSettingsCategories}),
+	))
+
+	return c.Send(i18n.T(lang, "settings.title", "lang", i18n.T(lang, "language.name"), "count", subscriptions), markup)
+}
+
+func (h *Handlers) HandleSettingsLanguage(c tele.Context, _ callback.Data) error {
+	_ = c.Respond()
+	return h.sendLanguagePicker(c, langFromCommand)
+}
+
+func (h *Handlers) HandleSettingsCategories(c tele.Context, _ callback.Data) error {
+	_ = c.Respond()
+	return h.HandleUnsubscribe(c)
+}
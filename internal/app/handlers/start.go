@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"html"
+	"ibTgBot/internal/app/db"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Префиксы параметра ссылки t.me/<бот>?start=<параметр>
+const (
+	startSubscribe = "sub_" // sub_<ID тега> - подписка на тег
+	startReferral  = "ref_" // ref_<Telegram ID> - приглашение от пользователя
+)
+
+// HandleStart регистрирует пользователя и ведет его через выбор языка и категорий.
+// Параметр ссылки sub_<ID тега> сразу подписывает на тег, ref_<ID> запоминает пригласившего
+func (h *Handlers) HandleStart(c tele.Context) error {
+	sender := c.Sender()
+	payload := strings.TrimSpace(c.Message().Payload)
+
+	user := contextUser(c)
+	isNew := user == nil
+	if isNew {
+		lang := senderLang(c)
+		if err := h.d.CreateUser(sender.ID, sender.Username, sender.FirstName, sender.LastName, lang); err != nil {
+			slog.Error("Ошибка при создании пользователя", "user_id", sender.ID, "error", err)
+			return c.Send(i18n.T(lang, "start.error"))
+		}
+		user = &db.User{ID: sender.ID, Lang: lang}
+		slog.Info("User started bot", "user_id", sender.ID, "lang", lang, "payload", payload)
+	}
+	name := html.EscapeString(sender.FirstName)
+
+	if referrer, ok := strings.CutPrefix(payload, startReferral); ok && isNew {
+		h.saveReferrer(sender.ID, referrer)
+	}
+
+	if tagId, ok := strings.CutPrefix(payload, startSubscribe); ok {
+		if isNew {
+			if err := c.Send(i18n.T(user.Lang, "start.welcome", "name", name), tele.ModeHTML); err != nil {
+				return err
+			}
+		}
+		return h.subscribeFromLink(c, user, tagId)
+	}
+
+	if !isNew {
+		return c.Send(i18n.T(user.Lang, "start.welcome_back", "name", name), tele.ModeHTML)
+	}
+	if err := c.Send(i18n.T(user.Lang, "start.welcome", "name", name), tele.ModeHTML); err != nil {
+		return err
+	}
+	return h.sendLanguagePicker(c, langFromSubscribe)
+}
+
+// subscribeFromLink подписывает пользователя на тег из ссылки, если он еще не подписан
+func (h *Handlers) subscribeFromLink(c tele.Context, user *db.User, value string) error {
+	tagId, err := strconv.Atoi(value)
+	tag, found := h.t.ByID(user.Lang, tagId)
+	if err != nil || !found || !tag.Active {
+		slog.Warn("Deep link tag not found", "user_id", user.ID, "tag", value, "lang", user.Lang)
+		return c.Send(i18n.T(user.Lang, "start.tag_not_found"))
+	}
+
+	if slices.Contains(user.Categories, tagId) {
+		return c.Send(i18n.T(user.Lang, "start.already", "tag", html.EscapeString(tag.Value)), tele.ModeHTML)
+	}
+
+	// ManageCategories переключает подписку, поэтому вызывается только для неподписанных
+	if _, err := h.d.ManageCategories(user.ID, &tagId); err != nil {
+		slog.Error("Ошибка при обновлении категорий пользователя", "user_id", user.ID, "tag_id", tagId, "error", err)
+		return c.Send(i18n.T(user.Lang, "start.error"))
+	}
+
+	slog.Info("User subscribed via deep link", "user_id", user.ID, "tag_id", tagId)
+	return c.Send(i18n.T(user.Lang, "start.subscribed", "tag", html.EscapeString(tag.Value)), tele.ModeHTML)
+}
+
+// saveReferrer запоминает пригласившего, ошибки не мешают регистрации
+func (h *Handlers) saveReferrer(userId int64, value string) {
+	referrerId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || referrerId == userId {
+		slog.Warn("Invalid referral link", "user_id", userId, "ref", value)
+		return
+	}
+
+	if err := h.d.SetReferrer(userId, referrerId); err != nil {
+		slog.Error("Ошибка при сохранении пригласившего пользователя", "user_id", userId, "referrer_id", referrerId, "error", err)
+		return
+	}
+	slog.Info("User referred", "user_id", userId, "referrer_id", referrerId)
+}
+
+// HandleMyChatMember отмечает пользователя заблокировавшим бота или снова разрешившим его,
+// чтобы рассылки и /stats учитывали актуальное состояние
+func (h *Handlers) HandleMyChatMember(c tele.Context) error {
+	update := c.ChatMember()
+	if update == nil || update.Chat == nil || update.Chat.Type != tele.ChatPrivate || update.NewChatMember == nil {
+		return nil
+	}
+
+	blocked := update.NewChatMember.Role == tele.Kicked
+	if err := h.d.SetBlocked(update.Chat.ID, blocked); err != nil {
+		return fmt.Errorf("SetBlocked user %d: %w", update.Chat.ID, err)
+	}
+	slog.Info("User changed bot status", "user_id", update.Chat.ID, "blocked", blocked)
+	return nil
+}
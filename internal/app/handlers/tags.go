@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	tele "gopkg.in/telebot.v4"
+	"html"
+	"ibTgBot/internal/app/i18n"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Лимит тегов в списке администратора
+const adminTagsLimit = 999
+
+// HandleTags выводит все теги, включая неактивные: /tags [язык]
+func (h *Handlers) HandleTags(c tele.Context) error {
+	ui := senderLang(c)
+	list := i18n.Langs()
+	if lang := strings.TrimSpace(c.Message().Payload); lang != "" {
+		if !isLang(lang) {
+			return c.Send(i18n.T(ui, "tags.usage", "langs", strings.Join(i18n.Langs(), "|")))
+		}
+		list = []string{lang}
+	}
+
+	var sb strings.Builder
+	for _, lang := range list {
+		// mainTag=false возвращает все теги, включая подтеги, неактивные теги в выборке есть всегда
+		tags, err := h.d.ReadTags(adminTagsLimit, false, lang)
+		if err != nil {
+			slog.Error("Ошибка при чтении тегов", "user_id", c.Sender().ID, "lang", lang, "error", err)
+			return c.Send(i18n.T(ui, "tags.read_error"))
+		}
+
+		fmt.Fprintf(&sb, "<b>%s</b> (%d)\n", lang, len(tags))
+		for _, tag := range tags {
+			mark := "✅"
+			if !tag.Active {
+				mark = "⏸"
+			}
+			fmt.Fprintf(&sb, "%s %d. %s\n", mark, tag.ID, html.EscapeString(tag.Value))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(i18n.T(ui, "tags.help"))
+
+	return c.Send(sb.String(), tele.ModeHTML)
+}
+
+// HandleTagAdd создает тег: /tag_add <язык> <название>
+func (h *Handlers) HandleTagAdd(c tele.Context) error {
+	args := strings.SplitN(strings.TrimSpace(c.Message().Payload), " ", 2)
+	if len(args) != 2 || !isLang(args[0]) || strings.TrimSpace(args[1]) == "" {
+		return c.Send(i18n.T(senderLang(c), "tags.add_usage"))
+	}
+
+	lang, value := args[0], strings.TrimSpace(args[1])
+	tagId, err := h.d.CreateTag(lang, value)
+	if err != nil {
+		slog.Error("Ошибка при создании тега", "user_id", c.Sender().ID, "lang", lang, "error", err)
+		return c.Send(i18n.T(senderLang(c), "tags.add_error"))
+	}
+
+	slog.Info("Tag created", "user_id", c.Sender().ID, "tag_id", tagId, "lang", lang, "value", value)
+	return h.tagsChanged(c, "", i18n.T(senderLang(c), "tags.created", "id", tagId))
+}
+
+// HandleTagRename переименовывает тег на языке: /tag_rename <id> <язык> <название>
+func (h *Handlers) HandleTagRename(c tele.Context) error {
+	tagId, lang, value, ok := tagValueArgs(c.Message().Payload)
+	if !ok {
+		return c.Send(i18n.T(senderLang(c), "tags.rename_usage"))
+	}
+	return h.setTagValue(c, tagId, lang, value)
+}
+
+// HandleTagTranslate задает перевод названия тега: /tag_translate <id> <язык> <название>
+func (h *Handlers) HandleTagTranslate(c tele.Context) error {
+	tagId, lang, value, ok := tagValueArgs(c.Message().Payload)
+	if !ok {
+		return c.Send(i18n.T(senderLang(c), "tags.translate_usage"))
+	}
+	return h.setTagValue(c, tagId, lang, value)
+}
+
+// tagValueArgs разбирает общие аргументы /tag_rename и /tag_translate: <id> <язык> <название>
+func tagValueArgs(payload string) (tagId int, lang, value string, ok bool) {
+	args := strings.SplitN(strings.TrimSpace(payload), " ", 3)
+	if len(args) != 3 || !isLang(args[1]) {
+		return 0, "", "", false
+	}
+	tagId, err := strconv.Atoi(args[0])
+	value = strings.TrimSpace(args[2])
+	if err != nil || value == "" {
+		return 0, "", "", false
+	}
+	return tagId, args[1], value, true
+}
+
+func (h *Handlers) setTagValue(c tele.Context, tagId int, lang, value string) error {
+	if err := h.d.SetTagValue(tagId, lang, value); err != nil {
+		slog.Error("Ошибка при изменении названия тега", "user_id", c.Sender().ID, "tag_id", tagId, "lang", lang, "error", err)
+		return c.Send(i18n.T(senderLang(c), "tags.value_error"))
+	}
+
+	slog.Info("Tag value set", "user_id", c.Sender().ID, "tag_id", tagId, "lang", lang, "value", value)
+	return h.tagsChanged(c, lang, i18n.T(senderLang(c), "tags.value_set", "id", tagId, "lang", lang, "value", value))
+}
+
+// HandleTagActive включает (/tag_on <id>) или отключает (/tag_off <id>) тег
+func (h *Handlers) HandleTagActive(active bool) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		tagId, err := strconv.Atoi(strings.TrimSpace(c.Message().Payload))
+		if err != nil {
+			return c.Send(i18n.T(senderLang(c), "tags.active_usage"))
+		}
+
+		if err := h.d.SetTagActive(tagId, active); err != nil {
+			slog.Error("Ошибка при изменении активности тега", "user_id", c.Sender().ID, "tag_id", tagId, "error", err)
+			return c.Send(i18n.T(senderLang(c), "tags.active_error"))
+		}
+
+		slog.Info("Tag activity changed", "user_id", c.Sender().ID, "tag_id", tagId, "active", active)
+		if active {
+			return h.tagsChanged(c, "", i18n.T(senderLang(c), "tags.enabled", "id", tagId))
+		}
+		return h.tagsChanged(c, "", i18n.T(senderLang(c), "tags.disabled", "id", tagId))
+	}
+}
+
+// HandleTagMove переносит тег на позицию: /tag_move <id> <позиция>
+func (h *Handlers) HandleTagMove(c tele.Context) error {
+	args := strings.Fields(c.Message().Payload)
+	if len(args) != 2 {
+		return c.Send(i18n.T(senderLang(c), "tags.move_usage"))
+	}
+	tagId, err := strconv.Atoi(args[0])
+	position, posErr := strconv.Atoi(args[1])
+	if err != nil || posErr != nil || position < 1 {
+		return c.Send(i18n.T(senderLang(c), "tags.move_usage"))
+	}
+
+	if err := h.d.MoveTag(tagId, position); err != nil {
+		slog.Error("Ошибка при перемещении тега", "user_id", c.Sender().ID, "tag_id", tagId, "error", err)
+		return c.Send(i18n.T(senderLang(c), "tags.move_error"))
+	}
+
+	slog.Info("Tag moved", "user_id", c.Sender().ID, "tag_id", tagId, "position", position)
+	return h.tagsChanged(c, "", i18n.T(senderLang(c), "tags.moved", "id", tagId, "position", position))
+}
+
+// tagsChanged обновляет каталог всех реплик и отвечает администратору,
+// пустой lang - изменились теги всех языков
+func (h *Handlers) tagsChanged(c tele.Context, lang, done string) error {
+	if err := h.t.Changed(lang); err != nil {
+		return c.Send(done + "\n" + i18n.T(senderLang(c), "tags.refresh_error"))
+	}
+	return c.Send(done)
+}
+
+// isLang проверяет, что для языка есть каталог сообщений
+func isLang(lang string) bool {
+	return slices.Contains(i18n.Langs(), lang)
+}
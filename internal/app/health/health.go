@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ibTgBot/configs"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Таймаут одной проверки готовности
+const checkTimeout = 2 * time.Second
+
+type Service interface {
+	Ready() error
+	LastUpdate() time.Time
+}
+
+type DB interface {
+	Ping(ctx context.Context) error
+}
+
+type Kafka interface {
+	Ready() error
+}
+
+type component struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type Status struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string            `json:"status"`
+	Components map[string]Status `json:"components"`
+	LastUpdate *time.Time        `json:"last_update,omitempty"`
+}
+
+type Health struct {
+	srv        *http.Server
+	s          Service
+	components []component
+}
+
+func New(conf *configs.Conf, s Service, d DB, k Kafka) *Health {
+	h := &Health{
+		s: s,
+		components: []component{
+			{"bot", func(context.Context) error { return s.Ready() }},
+			{"db", d.Ping},
+			{"kafka", func(context.Context) error { return k.Ready() }},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+	h.srv = &http.Server{Addr: conf.Health.Listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	return h
+}
+
+// Run запускает HTTP сервер проверок, пустой адрес отключает сервер
+func (h *Health) Run() error {
+	if h.srv.Addr == "" {
+		slog.Info("Health endpoints disabled")
+		return nil
+	}
+
+	slog.Info("Health endpoints started", "listen", h.srv.Addr)
+	if err := h.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (h *Health) Stop(ctx context.Context) error {
+	return h.srv.Shutdown(ctx)
+}
+
+// Healthz отвечает, пока процесс жив
+func (h *Health) Healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, Status{Status: "ok"})
+}
+
+// Readyz проверяет все компоненты параллельно и возвращает их состояние
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+
+	code := http.StatusOK
+	if report.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+// Check выполняет проверки компонентов, используется также командой /health
+func (h *Health) Check(ctx context.Context) Report {
+	report := Report{Status: "ok", Components: make(map[string]Status, len(h.components))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range h.components {
+		wg.Add(1)
+		go func(c component) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			status := Status{Status: "ok"}
+			if err := c.check(ctx); err != nil {
+				status = Status{Status: "fail", Error: err.Error()}
+			}
+
+			mu.Lock()
+			report.Components[c.name] = status
+			if status.Status != "ok" {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	if last := h.s.LastUpdate(); !last.IsZero() {
+		report.LastUpdate = &last
+	}
+
+	return report
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write health response", "error", err)
+	}
+}
@@ -0,0 +1,274 @@
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fallback язык, из которого берутся отсутствующие в переводе сообщения
+const Fallback = "ru"
+
+//go:embed locales/*.yaml
+var locales embed.FS
+
+// Формы множественного числа в каталоге
+var pluralForms = map[string]bool{"zero": true, "one": true, "few": true, "many": true, "other": true}
+
+// message простое сообщение или набор форм множественного числа
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+var catalog = make(map[string]map[string]message)
+
+// Сообщения из секции messages конфигурации, заменяют сообщения каталога
+var (
+	overridesMu sync.RWMutex
+	overrides   = make(map[string]map[string]message)
+)
+
+func init() {
+	if err := load(); err != nil {
+		panic(err)
+	}
+}
+
+// load читает каталоги всех языков из locales/<язык>.yaml
+func load() error {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return fmt.Errorf("i18n: read locales: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := locales.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return fmt.Errorf("i18n: read %s: %w", file.Name(), err)
+		}
+
+		var tree map[string]interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return fmt.Errorf("i18n: parse %s: %w", file.Name(), err)
+		}
+
+		messages := make(map[string]message)
+		if err := flatten("", tree, messages); err != nil {
+			return fmt.Errorf("i18n: %s: %w", file.Name(), err)
+		}
+		catalog[strings.TrimSuffix(file.Name(), ".yaml")] = messages
+	}
+
+	if _, ok := catalog[Fallback]; !ok {
+		return fmt.Errorf("i18n: fallback locale %q not found", Fallback)
+	}
+	return nil
+}
+
+// flatten разворачивает вложенные секции в ключи вида "broadcast.sent"
+func flatten(prefix string, tree map[string]interface{}, messages map[string]message) error {
+	for name, value := range tree {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch v := value.(type) {
+		case string:
+			messages[key] = message{text: v}
+		case map[string]interface{}:
+			if isPlural(v) {
+				forms := make(map[string]string, len(v))
+				for form, text := range v {
+					forms[form] = fmt.Sprint(text)
+				}
+				messages[key] = message{plural: forms}
+				continue
+			}
+			if err := flatten(key, v, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected value of %s: %v", key, value)
+		}
+	}
+	return nil
+}
+
+func isPlural(v map[string]interface{}) bool {
+	for form := range v {
+		if !pluralForms[form] {
+			return false
+		}
+	}
+	return len(v) > 0
+}
+
+// SetOverrides заменяет сообщения каталога текстами из конфигурации
+// (messages { ru { broadcast { sent = "..." } } }). Язык и ключ должны быть
+// в каталоге, иначе ни одно сообщение не заменяется
+func SetOverrides(messages map[string]map[string]interface{}) error {
+	next := make(map[string]map[string]message, len(messages))
+	for lang, tree := range messages {
+		if !Has(lang) {
+			return fmt.Errorf("i18n: unknown language %q in messages", lang)
+		}
+
+		flat := make(map[string]message)
+		if err := flatten("", tree, flat); err != nil {
+			return fmt.Errorf("i18n: messages.%s: %w", lang, err)
+		}
+		for key, msg := range flat {
+			orig, ok := catalog[Fallback][key]
+			if !ok {
+				return fmt.Errorf("i18n: unknown message messages.%s.%s", lang, key)
+			}
+			if (orig.plural == nil) != (msg.plural == nil) {
+				return fmt.Errorf("i18n: messages.%s.%s: plural forms do not match the catalog", lang, key)
+			}
+		}
+		next[lang] = flat
+	}
+
+	overridesMu.Lock()
+	overrides = next
+	overridesMu.Unlock()
+	return nil
+}
+
+// lookup ищет сообщение сначала среди замен из конфигурации, затем в каталоге
+func lookup(lang, key string) (message, bool) {
+	overridesMu.RLock()
+	msg, ok := overrides[lang][key]
+	overridesMu.RUnlock()
+	if ok {
+		return msg, true
+	}
+	msg, ok = catalog[lang][key]
+	return msg, ok
+}
+
+// T возвращает сообщение key на языке lang. Аргументы передаются парами
+// имя-значение и подставляются вместо {имя}, аргумент count выбирает
+// форму множественного числа:
+//
+//	i18n.T("ru", "broadcast.started", "count", 5) // Рассылка запущена: 5 получателей
+//
+// Если сообщения нет на языке lang, используется Fallback, если нет и там - сам ключ
+func T(lang, key string, args ...interface{}) string {
+	msg, ok := lookup(lang, key)
+	if !ok {
+		lang = Fallback
+		if msg, ok = lookup(Fallback, key); !ok {
+			return key
+		}
+	}
+
+	text := msg.text
+	if msg.plural != nil {
+		text = msg.plural[pluralForm(lang, count(args))]
+		if text == "" {
+			text = msg.plural["other"]
+		}
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Has сообщает, есть ли каталог для языка
+func Has(lang string) bool {
+	_, ok := catalog[lang]
+	return ok
+}
+
+// Langs возвращает языки, для которых есть каталог: Fallback первым, остальные по алфавиту.
+// Это единственный список языков бота, новый язык добавляется файлом в locales
+func Langs() []string {
+	list := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		if lang != Fallback {
+			list = append(list, lang)
+		}
+	}
+	sort.Strings(list)
+	return append([]string{Fallback}, list...)
+}
+
+// Языки без своего каталога и язык, который им предлагается
+var aliases = map[string]string{
+	"uk": "ru",
+	"be": "ru",
+	"kk": "ru",
+	"ky": "ru",
+	"uz": "ru",
+	"pt": "es",
+	"gl": "es",
+	"ca": "es",
+	"it": "es",
+}
+
+// Match возвращает язык каталога для language_code пользователя Telegram
+// с учетом таблицы aliases, например uk -> ru, pt-BR -> es
+func Match(code string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(code), "-")
+	if Has(lang) {
+		return lang
+	}
+	if alias, ok := aliases[lang]; ok && Has(alias) {
+		return alias
+	}
+	return Fallback
+}
+
+func count(args []interface{}) int {
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] != "count" {
+			continue
+		}
+		switch n := args[i+1].(type) {
+		case int:
+			return n
+		case int64:
+			return int(n)
+		case int32:
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// pluralForm правила множественного числа CLDR для поддерживаемых языков
+func pluralForm(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch lang {
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
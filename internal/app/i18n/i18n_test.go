@@ -0,0 +1,98 @@
+package i18n
+
+import "testing"
+
+func TestPluralForm(t *testing.T) {
+	cases := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"ru", 0, "many"},
+		{"ru", 1, "one"},
+		{"ru", 2, "few"},
+		{"ru", 4, "few"},
+		{"ru", 5, "many"},
+		{"ru", 11, "many"},
+		{"ru", 12, "many"},
+		{"ru", 14, "many"},
+		{"ru", 21, "one"},
+		{"ru", 22, "few"},
+		{"ru", 111, "many"},
+		{"ru", -1, "one"},
+		{"es", 0, "other"},
+		{"es", 1, "one"},
+		{"es", 2, "other"},
+		{"es", 21, "other"},
+	}
+	for _, tc := range cases {
+		if got := pluralForm(tc.lang, tc.n); got != tc.want {
+			t.Errorf("pluralForm(%q, %d) = %q, want %q", tc.lang, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	// Сообщение только в Fallback, чтобы проверить подстановку перевода
+	catalog[Fallback]["test.only_fallback"] = message{text: "только {name}"}
+	t.Cleanup(func() { delete(catalog[Fallback], "test.only_fallback") })
+
+	cases := []struct {
+		name string
+		lang string
+		key  string
+		args []interface{}
+		want string
+	}{
+		{"ru one", "ru", "mysubs.title", []interface{}{"count", 1}, "Вы подписаны на 1 категорию:"},
+		{"ru few", "ru", "mysubs.title", []interface{}{"count", 3}, "Вы подписаны на 3 категории:"},
+		{"ru many", "ru", "mysubs.title", []interface{}{"count", 11}, "Вы подписаны на 11 категорий:"},
+		{"ru int64", "ru", "alerts.more", []interface{}{"count", int64(2)}, "⚠️ И еще 2 вида ошибок:"},
+		{"es one", "es", "alerts.more", []interface{}{"count", 1}, "⚠️ Y 1 tipo de error más:"},
+		{"es other", "es", "alerts.more", []interface{}{"count", 5}, "⚠️ Y 5 tipos de error más:"},
+		{"missing in lang", "es", "test.only_fallback", []interface{}{"name", "ru"}, "только ru"},
+		{"unknown lang", "de", "common.disabled", nil, "Эта функция временно отключена"},
+		{"missing key", "es", "no.such.key", nil, "no.such.key"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := T(tc.lang, tc.key, tc.args...); got != tc.want {
+				t.Errorf("T(%q, %q) = %q, want %q", tc.lang, tc.key, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetOverrides(t *testing.T) {
+	t.Cleanup(func() { _ = SetOverrides(nil) })
+
+	cases := []struct {
+		name     string
+		messages map[string]map[string]interface{}
+		wantErr  bool
+	}{
+		{"text", map[string]map[string]interface{}{"es": {"common": map[string]interface{}{"disabled": "Apagado"}}}, false},
+		{"unknown lang", map[string]map[string]interface{}{"de": {"common": map[string]interface{}{"disabled": "Aus"}}}, true},
+		{"unknown key", map[string]map[string]interface{}{"ru": {"common": map[string]interface{}{"nope": "x"}}}, true},
+		{"plural mismatch", map[string]map[string]interface{}{"ru": {"alerts": map[string]interface{}{"more": "x"}}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = SetOverrides(nil)
+			err := SetOverrides(tc.messages)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("SetOverrides() error = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				// Некорректные замены не применяются
+				if got := T("es", "common.disabled"); got != "Esta función está desactivada temporalmente" {
+					t.Errorf("T after rejected overrides = %q", got)
+				}
+				return
+			}
+			if got := T("es", "common.disabled"); got != "Apagado" {
+				t.Errorf("T with override = %q, want %q", got, "Apagado")
+			}
+		})
+	}
+}
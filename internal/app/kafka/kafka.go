@@ -1,28 +1,59 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	tele "gopkg.in/telebot.v4"
 	"ibTgBot/configs"
-	"log"
+	"ibTgBot/internal/app/metrics"
+	"ibTgBot/internal/app/redact"
+	"ibTgBot/internal/app/tracing"
+	"log/slog"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Kafka struct {
-	reUrlId *regexp.Regexp
-	reTagId *regexp.Regexp
-	re429   *regexp.Regexp // Ошибка 429 ТГ лимит отправки сообщений
-	EsTopic string
-	RuTopic string
-	EsCanal int64
-	RuCanal int64
-	s       Service
-	d       DB
+	reUrlId   *regexp.Regexp
+	reTagId   *regexp.Regexp
+	re429     *regexp.Regexp // Ошибка 429 ТГ лимит отправки сообщений
+	EsTopic   string
+	RuTopic   string
+	TagsTopic string       // События изменения тегов
+	DlqTopic  string       // Сообщения, которые не удалось обработать
+	esCanal   atomic.Int64 // Каналы меняются при перечитывании конфигурации
+	ruCanal   atomic.Int64
+	s         Service
+	d         DB
+	t         Tags
+	a         Alerts
+	f         Features
+	attached  sync.Map // Топики, к партициям которых подключены потребители
+
+	stop      chan struct{}  // Закрывается в Stop, потребители завершают чтение
+	consumers sync.WaitGroup // Потребители топиков
+	posts     sync.WaitGroup // Посты, которые публикуются и рассылаются подписчикам
+
+	producerMu sync.Mutex
+	producer   sarama.SyncProducer // Создается при первой записи в DlqTopic или TagsTopic
 }
 
+// Пауза перед переподключением потребителя, удваивается после каждой неудачи
+const (
+	reconnectMin = time.Second
+	reconnectMax = time.Minute
+)
+
 type Service interface {
 	GetBot() *tele.Bot
 	GetTG() configs.TgConfig
@@ -31,24 +62,105 @@ type Service interface {
 type DB interface {
 	SetMsgId(msgId int, urlId, clientId string)
 	GetSubscribers(tagId, lang string) ([]int, error)
+	SetBlocked(userId int64, blocked bool) error
+	LogDeliveries(kind string, count int) error
+}
+
+type Tags interface {
+	Refresh(lang string) error
+}
+
+type Alerts interface {
+	Report(source string, err error, attrs ...any)
+}
+
+type Features interface {
+	Enabled(name string) bool
 }
 
-func New(s Service, d DB) *Kafka {
-	return &Kafka{
-		reUrlId: regexp.MustCompile(`\(urlId: (\d+)\)`),
-		reTagId: regexp.MustCompile(`\(tagId: (\d+)\)`),
-		re429:   regexp.MustCompile(`retry after \d+ \(429\)`),
-		EsTopic: "esInfobot",
-		RuTopic: "ruInfobot",
-		EsCanal: s.GetTG().EsCanal,
-		RuCanal: s.GetTG().RuCanal,
-		s:       s, d: d,
+// Флаг features, отключающий рассылку постов подписчикам тегов
+const subscribersFeature = "subscribers"
+
+func New(s Service, d DB, t Tags, a Alerts, f Features) *Kafka {
+	k := &Kafka{
+		reUrlId:   regexp.MustCompile(`\(urlId: (\d+)\)`),
+		reTagId:   regexp.MustCompile(`\(tagId: (\d+)\)`),
+		re429:     regexp.MustCompile(`retry after \d+ \(429\)`),
+		EsTopic:   "esInfobot",
+		RuTopic:   "ruInfobot",
+		TagsTopic: "tagsInfobot",
+		DlqTopic:  "dlqInfobot",
+		s:         s, d: d, t: t, a: a, f: f,
+		stop: make(chan struct{}),
 	}
+	k.SetChannels(s.GetTG().RuCanal, s.GetTG().EsCanal)
+	return k
 }
 
 func (k *Kafka) Run() {
-	go k.KafkaRead("es", k.EsTopic, k.EsCanal)
-	go k.KafkaRead("ru", k.RuTopic, k.RuCanal)
+	k.consumers.Add(3)
+	go func() { defer k.consumers.Done(); k.KafkaRead("es", k.EsTopic) }()
+	go func() { defer k.consumers.Done(); k.KafkaRead("ru", k.RuTopic) }()
+	go func() { defer k.consumers.Done(); k.KafkaReadTags(k.TagsTopic) }()
+}
+
+// Stop закрывает потребителей и ждет обработки уже полученных постов, затем закрывает
+// производителя. Вызывается до закрытия БД: обработка поста пишет в нее номер сообщения
+func (k *Kafka) Stop(ctx context.Context) error {
+	close(k.stop)
+
+	done := make(chan struct{})
+	go func() {
+		// Новые посты появляются только в потребителях, поэтому сначала ждем их
+		k.consumers.Wait()
+		k.posts.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("kafka: posts are still being processed: %w", ctx.Err())
+	}
+
+	k.producerMu.Lock()
+	defer k.producerMu.Unlock()
+	if k.producer != nil {
+		if err := k.producer.Close(); err != nil {
+			return fmt.Errorf("failed to close Kafka producer: %w", err)
+		}
+		k.producer = nil
+	}
+	return nil
+}
+
+// SetChannels меняет каналы публикации постов, применяется к следующему сообщению
+func (k *Kafka) SetChannels(ru, es int64) {
+	k.ruCanal.Store(ru)
+	k.esCanal.Store(es)
+}
+
+// channel возвращает канал публикации для языка потребителя
+func (k *Kafka) channel(clientId string) int64 {
+	if clientId == "es" {
+		return k.esCanal.Load()
+	}
+	return k.ruCanal.Load()
+}
+
+// Ready проверяет, что потребители всех топиков подключены к своим партициям
+func (k *Kafka) Ready() error {
+	var detached []string
+	for _, topic := range []string{k.EsTopic, k.RuTopic, k.TagsTopic} {
+		if _, ok := k.attached.Load(topic); !ok {
+			detached = append(detached, topic)
+		}
+	}
+
+	if len(detached) > 0 {
+		return fmt.Errorf("consumers are not attached: %s", strings.Join(detached, ", "))
+	}
+	return nil
 }
 
 func (k *Kafka) KafkaConfig() *sarama.Config {
@@ -58,143 +170,417 @@ func (k *Kafka) KafkaConfig() *sarama.Config {
 	return config
 }
 
-func (k *Kafka) KafkaClient() sarama.Client {
+func (k *Kafka) KafkaClient() (sarama.Client, error) {
 	client, err := sarama.NewClient([]string{"localhost:9092"}, k.KafkaConfig())
 	if err != nil {
-		log.Fatalf("Failed to create Kafka client: %s", err)
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
 	}
-	return client
+	return client, nil
 }
 
-func (k *Kafka) KafkaConsumer(client sarama.Client) sarama.Consumer {
+func (k *Kafka) KafkaConsumer(client sarama.Client) (sarama.Consumer, error) {
 	consumer, err := sarama.NewConsumerFromClient(client)
 	if err != nil {
-		log.Fatalf("Failed to start consumer: %s", err)
+		return nil, fmt.Errorf("failed to start consumer: %w", err)
 	}
-	return consumer
+	return consumer, nil
 }
 
-func (k *Kafka) KafkaOffsetManager(client sarama.Client) sarama.OffsetManager {
+func (k *Kafka) KafkaOffsetManager(client sarama.Client) (sarama.OffsetManager, error) {
 	offsetManager, err := sarama.NewOffsetManagerFromClient("consumerGroup", client) //ibTgClient
 	if err != nil {
-		log.Fatalf("Failed to create offset manager: %s", err)
+		return nil, fmt.Errorf("failed to create offset manager: %w", err)
 	}
-	return offsetManager
-
+	return offsetManager, nil
 }
 
-func (k *Kafka) SendMsg(messageBody string, telegramChannel int64) (int, error) {
+func (k *Kafka) SendMsg(ctx context.Context, messageBody string, telegramChannel int64) (int, error) {
+	_, span := tracing.Tracer().Start(ctx, "telegram.send", trace.WithAttributes(
+		attribute.Int64("chat_id", telegramChannel),
+		attribute.String("chat_type", metrics.ChatType(telegramChannel)),
+	))
+	defer span.End()
+
+	var lastErr error
 	for attempts := 1; attempts <= 3; attempts++ { // Повторяем попытку отправки сообщения 3 раза
+		span.SetAttributes(attribute.Int("attempts", attempts))
+		start := time.Now()
 		msg, err := k.s.GetBot().Send(tele.ChatID(telegramChannel),
 			messageBody,
 			&tele.SendOptions{
 				ParseMode:           tele.ModeHTML,
 				DisableNotification: true,
 			})
+		metrics.ObserveSend(telegramChannel, start, err)
 
 		if err != nil {
+			lastErr = err
+			span.RecordError(err)
+			// Пользователь заблокировал бота, повторять бесполезно
+			if errors.Is(err, tele.ErrBlockedByUser) || errors.Is(err, tele.ErrUserIsDeactivated) {
+				return -1, err
+			}
 			if attempts < 3 && k.re429.MatchString(err.Error()) {
-				log.Printf("Failed to send message to Telegram: %s, retrying in %d seconds...", err, 2*attempts)
+				slog.Warn("Failed to send message to Telegram, retrying",
+					"chat_id", telegramChannel, "attempt", attempts, "retry_in", 2*attempts, "error", err)
 				time.Sleep(time.Duration(2*attempts) * time.Second)
 				continue
 			}
-			log.Printf("Failed to send message to Telegram after %d attempts: %s", attempts, err)
-			log.Printf("Message: %s", messageBody)
+			slog.Error("Failed to send message to Telegram",
+				"chat_id", telegramChannel, "attempts", attempts, "error", err)
+			slog.Debug("Failed message", "chat_id", telegramChannel, "message", messageBody)
 		} else {
-			//go k.d.SetMsgId(msg.ID, urlId, clientId)
-			log.Printf("Message sent to Telegram channel: %s, urlId: %s",
-				strconv.FormatInt(telegramChannel, 10))
+			span.SetAttributes(attribute.Int("msg_id", msg.ID))
+			slog.Info("Message sent to Telegram", "chat_id", telegramChannel, "msg_id", msg.ID)
 			return msg.ID, nil
 		}
 		time.Sleep(time.Duration(1*attempts) * time.Second)
 	}
-	return -1, nil
+	span.SetStatus(codes.Error, "message was not sent")
+	k.a.Report("telegram", lastErr, "chat_id", telegramChannel, "attempts", 3)
+	return -1, lastErr
 }
 
-func (k *Kafka) SendSubscribers(tagId, lang, message string) {
+func (k *Kafka) SendSubscribers(ctx context.Context, tagId, lang, message string) {
+	_, span := tracing.Tracer().Start(ctx, "db.GetSubscribers", trace.WithAttributes(
+		attribute.String("tag_id", tagId), attribute.String("lang", lang),
+	))
 	subscribers, err := k.d.GetSubscribers(tagId, lang)
 	if err != nil {
-		log.Printf("Failed to get subscribers: %s", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		slog.Error("Failed to get subscribers", "tag_id", tagId, "lang", lang, "error", err)
 		return
 	}
+	span.SetAttributes(attribute.Int("subscribers", len(subscribers)))
+	span.End()
 
-	if len(subscribers) > 0 {
-		for _, subscriber := range subscribers {
-			go k.SendMsg(message, int64(subscriber))
-		}
+	metrics.FanOut.Observe(float64(len(subscribers)))
+	if len(subscribers) == 0 {
+		return
+	}
+
+	var (
+		wg        sync.WaitGroup
+		delivered atomic.Int64
+	)
+	for _, subscriber := range subscribers {
+		wg.Add(1)
+		go func(userId int64) {
+			defer wg.Done()
+			_, err := k.SendMsg(ctx, message, userId)
+			switch {
+			case err == nil:
+				delivered.Add(1)
+			case errors.Is(err, tele.ErrBlockedByUser), errors.Is(err, tele.ErrUserIsDeactivated):
+				if err := k.d.SetBlocked(userId, true); err != nil {
+					slog.Error("Failed to mark user as blocked", "user_id", userId, "error", err)
+				}
+			}
+		}(int64(subscriber))
+	}
+	wg.Wait()
+
+	if err := k.d.LogDeliveries("subscribers", int(delivered.Load())); err != nil {
+		slog.Error("Failed to log deliveries", "tag_id", tagId, "lang", lang, "error", err)
 	}
 }
 
-func (k *Kafka) SendToTelegram(message, clientId string, telegramChannel int64) {
+// SendToTelegram публикует пост в канале и рассылает подписчикам тега.
+// Ошибка означает, что пост не опубликован и сообщение нужно отложить в DLQ
+func (k *Kafka) SendToTelegram(ctx context.Context, message, clientId string, telegramChannel int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "post.process", trace.WithAttributes(
+		attribute.String("lang", clientId), attribute.Int64("chat_id", telegramChannel),
+	))
+	defer span.End()
+
+	_, parseSpan := tracing.Tracer().Start(ctx, "post.parse")
 	urlIdMatch := k.reUrlId.FindStringSubmatch(message)
 	tagIdMatch := k.reTagId.FindStringSubmatch(message)
+	if urlIdMatch == nil {
+		parseSpan.End()
+		span.SetStatus(codes.Error, "urlId not found")
+		return errors.New("message has no urlId")
+	}
 	urlId := urlIdMatch[1]
 	messageBody := strings.TrimSpace(strings.Replace(message, urlIdMatch[0], "", 1))
+	parseSpan.SetAttributes(attribute.String("url_id", urlId))
+	parseSpan.End()
 
-	if len(tagIdMatch) > 1 {
+	// Рассылка подписчикам идет параллельно с публикацией в канале, SendToTelegram
+	// ждет ее завершения, чтобы спаны поста покрывали всю обработку
+	var subscribers sync.WaitGroup
+	defer subscribers.Wait()
+	if len(tagIdMatch) > 1 && k.f.Enabled(subscribersFeature) {
 		tagId := tagIdMatch[1]
-		go k.SendSubscribers(tagId, clientId, messageBody)
+		subscribers.Add(1)
+		go func() {
+			defer subscribers.Done()
+			k.SendSubscribers(ctx, tagId, clientId, messageBody)
+		}()
 	}
 
-	msgId, err := k.SendMsg(messageBody, telegramChannel)
+	msgId, err := k.SendMsg(ctx, messageBody, telegramChannel)
 	if err != nil || msgId == -1 {
-		log.Printf("Ошибка отправки сообщения Телеграмм: %s", err)
-	} else {
-		// Помечаю сообщение как отправленное и присваиваю номер
-		go k.d.SetMsgId(msgId, urlId, clientId)
+		span.SetStatus(codes.Error, "channel send failed")
+		slog.Error("Ошибка отправки сообщения Телеграмм", "chat_id", telegramChannel, "url_id", urlId, "error", err)
+		return fmt.Errorf("send post %s to channel %d: %w", urlId, telegramChannel, err)
 	}
+
+	// Помечаю сообщение как отправленное и присваиваю номер
+	_, dbSpan := tracing.Tracer().Start(ctx, "db.SetMsgId", trace.WithAttributes(
+		attribute.String("url_id", urlId), attribute.Int("msg_id", msgId),
+	))
+	k.d.SetMsgId(msgId, urlId, clientId)
+	dbSpan.End()
+	return nil
 }
 
-func (k *Kafka) KafkaRead(clientId, topic string, telegramChannel int64) {
-	log.Printf("Initializing %s Kafka consumer...", clientId)
+func (k *Kafka) KafkaRead(clientId, topic string) {
+	k.KafkaConsume(clientId, topic, func(msg *sarama.ConsumerMessage) {
+		telegramChannel := k.channel(clientId)
+		// Контекст трассировки приходит в заголовках сообщения
+		ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), msg), "kafka.receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("topic", msg.Topic),
+				attribute.Int("partition", int(msg.Partition)),
+				attribute.Int64("offset", msg.Offset),
+			))
+
+		slog.Info("Sending message to Telegram channel", "topic", msg.Topic, "offset", msg.Offset, "chat_id", telegramChannel)
+		message := string(msg.Value)
+		// Отправка сообщения в Telegram, неопубликованный пост откладывается в DLQ
+		// Спан kafka.receive покрывает обработку поста и завершается после нее
+		k.posts.Add(1)
+		go func() {
+			defer k.posts.Done()
+			defer span.End()
+			defer k.recoverMessage(msg)
+			if err := k.SendToTelegram(ctx, message, clientId, telegramChannel); err != nil {
+				k.deadLetter(msg, err)
+			}
+		}()
+	})
+}
+
+// KafkaReadTags обновляет каталог тегов по событию изменения тегов.
+// Тело сообщения содержит код языка, пустое тело обновляет все языки
+func (k *Kafka) KafkaReadTags(topic string) {
+	k.KafkaConsume("tags", topic, func(msg *sarama.ConsumerMessage) {
+		lang := strings.TrimSpace(string(msg.Value))
+		slog.Info("Tags changed event received", "topic", msg.Topic, "offset", msg.Offset, "lang", lang)
+		if err := k.t.Refresh(lang); err != nil {
+			slog.Error("Failed to refresh tags catalog", "lang", lang, "error", err)
+		}
+	})
+}
+
+// PublishTagsChanged публикует событие изменения тегов в TagsTopic, по нему каталог
+// перечитывают все реплики бота. Пустой lang означает изменение тегов всех языков
+func (k *Kafka) PublishTagsChanged(lang string) error {
+	producer, err := k.syncProducer()
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{
+		Topic: k.TagsTopic,
+		Value: sarama.StringEncoder(lang),
+	}); err != nil {
+		return fmt.Errorf("failed to publish tags changed event: %w", err)
+	}
+	return nil
+}
+
+// KafkaConsume читает топик и передает сообщения в handle. При ошибке подключения
+// потребитель переподключается с нарастающей паузой, процесс продолжает работу.
+// Возвращается после вызова Stop
+func (k *Kafka) KafkaConsume(clientId, topic string, handle func(msg *sarama.ConsumerMessage)) {
+	delay := reconnectMin
+	for {
+		started := time.Now()
+		err := k.consume(clientId, topic, handle)
+		if k.stopped() {
+			slog.Info("Kafka consumer stopped", "client_id", clientId, "topic", topic)
+			return
+		}
+
+		// Потребитель проработал долго, значит это новая проблема, а не повторная
+		if time.Since(started) > reconnectMax {
+			delay = reconnectMin
+		}
+		slog.Error("Kafka consumer stopped, reconnecting", "client_id", clientId, "topic", topic, "retry_in", delay, "error", err)
+		k.a.Report("kafka", err, "client_id", clientId, "topic", topic, "retry_in", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-k.stop:
+			return
+		}
+		delay = min(delay*2, reconnectMax)
+	}
+}
+
+func (k *Kafka) stopped() bool {
+	select {
+	case <-k.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (k *Kafka) consume(clientId, topic string, handle func(msg *sarama.ConsumerMessage)) error {
+	slog.Info("Initializing Kafka consumer", "client_id", clientId, "topic", topic)
 	// Создаем нового клиента
-	client := k.KafkaClient()
+	client, err := k.KafkaClient()
+	if err != nil {
+		return err
+	}
 	defer client.Close()
 
 	// Создаем нового потребителя
-	consumer := k.KafkaConsumer(client)
+	consumer, err := k.KafkaConsumer(client)
+	if err != nil {
+		return err
+	}
 	defer consumer.Close()
 
 	// Создаем менеджер смещений
-	offsetManager := k.KafkaOffsetManager(client)
+	offsetManager, err := k.KafkaOffsetManager(client)
+	if err != nil {
+		return err
+	}
 	defer offsetManager.Close()
 
 	// Создаем менеджер смещений для каждой партиции
 	partitionOffsetManager, err := offsetManager.ManagePartition(topic, 0)
 	if err != nil {
-		log.Fatalf("Failed to create partition offset manager: %s", err)
+		return fmt.Errorf("failed to create partition offset manager: %w", err)
 	}
 	defer partitionOffsetManager.Close()
 
 	// Читаем текущее смещение из OffsetManager
 	offset, _ := partitionOffsetManager.NextOffset()
-	log.Printf("Starting at offset: %d", offset)
+	slog.Info("Starting at offset", "topic", topic, "offset", offset)
 	if offset == sarama.OffsetNewest || offset == sarama.OffsetOldest {
 		offset = sarama.OffsetOldest // Начнем с самого старого сообщения, если нет сохраненного смещения
 	}
 
-	log.Printf("Subscribed to Kafka topic %s...", topic)
+	slog.Info("Subscribed to Kafka topic", "topic", topic)
 	// Подписываемся на топик с использованием текущего смещения
 	partitionConsumer, err := consumer.ConsumePartition(topic, 0, offset)
 	if err != nil {
-		log.Fatalf("Failed to start partition consumer: %s", err)
+		return fmt.Errorf("failed to start partition consumer: %w", err)
 	}
 	defer partitionConsumer.Close()
 
+	k.attached.Store(topic, true)
+	defer k.attached.Delete(topic)
+
 	// Чтение сообщений в цикле
 	for {
-		log.Println("Waiting for messages from Kafka...")
+		slog.Debug("Waiting for messages from Kafka", "topic", topic)
 		select {
-		case msg := <-partitionConsumer.Messages():
-			log.Println("Sending message to Telegram channel...")
-			message := string(msg.Value)
-			// Отправка сообщения в Telegram
-			go k.SendToTelegram(message, clientId, telegramChannel)
+		case msg, ok := <-partitionConsumer.Messages():
+			if !ok {
+				return errors.New("partition consumer closed")
+			}
+			metrics.KafkaConsumed.WithLabelValues(topic).Inc()
+			// Отставание от последнего сообщения в партиции
+			metrics.KafkaLag.WithLabelValues(topic).Set(float64(partitionConsumer.HighWaterMarkOffset() - msg.Offset - 1))
+			k.process(msg, handle)
 			// Коммит смещения
 			partitionOffsetManager.MarkOffset(msg.Offset+1, "")
 
 		case err := <-partitionConsumer.Errors():
-			log.Printf("Error: %s", err)
+			slog.Error("Kafka consumer error", "topic", topic, "error", err)
+			k.a.Report("kafka", err, "client_id", clientId, "topic", topic)
+
+		case <-k.stop:
+			return nil
 		}
 	}
 }
+
+// process обрабатывает сообщение. Паника в обработчике не останавливает потребителя,
+// сообщение откладывается в DLQ
+func (k *Kafka) process(msg *sarama.ConsumerMessage, handle func(msg *sarama.ConsumerMessage)) {
+	defer k.recoverMessage(msg)
+	handle(msg)
+}
+
+// recoverMessage перехватывает панику при обработке сообщения, вызывается через defer
+func (k *Kafka) recoverMessage(msg *sarama.ConsumerMessage) {
+	if r := recover(); r != nil {
+		slog.Error("Паника при обработке сообщения Kafka", "topic", msg.Topic, "offset", msg.Offset,
+			"panic", r, "stack", string(debug.Stack()))
+		k.deadLetter(msg, fmt.Errorf("panic: %v", r))
+	}
+}
+
+// deadLetter откладывает сообщение в DlqTopic, исходный топик, смещение и причина
+// передаются в заголовках. Рост очереди попадает в отчеты администраторам
+func (k *Kafka) deadLetter(msg *sarama.ConsumerMessage, reason error) {
+	metrics.KafkaDLQ.WithLabelValues(msg.Topic).Inc()
+	k.a.Report("dlq", reason, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+
+	producer, err := k.syncProducer()
+	if err != nil {
+		slog.Error("Сообщение не отложено в DLQ", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+		k.a.Report("kafka", err, "topic", k.DlqTopic)
+		return
+	}
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte("x-original-topic"), Value: []byte(msg.Topic)},
+		{Key: []byte("x-original-partition"), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		{Key: []byte("x-original-offset"), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		{Key: []byte("x-error"), Value: []byte(redact.String(reason.Error()))},
+	}
+	// Заголовки исходного сообщения, в том числе контекст трассировки
+	for _, header := range msg.Headers {
+		if header != nil {
+			headers = append(headers, *header)
+		}
+	}
+
+	_, offset, err := producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   k.DlqTopic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		slog.Error("Сообщение не отложено в DLQ", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+		k.a.Report("kafka", fmt.Errorf("failed to write to DLQ: %w", err), "topic", k.DlqTopic)
+		return
+	}
+
+	slog.Warn("Message moved to DLQ", "topic", msg.Topic, "offset", msg.Offset,
+		"dlq_topic", k.DlqTopic, "dlq_offset", offset, "reason", reason)
+}
+
+// syncProducer возвращает производителя для DlqTopic и TagsTopic. Если создать его
+// не удалось, попытка повторяется при следующей записи
+func (k *Kafka) syncProducer() (sarama.SyncProducer, error) {
+	k.producerMu.Lock()
+	defer k.producerMu.Unlock()
+
+	if k.producer != nil {
+		return k.producer, nil
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	producer, err := sarama.NewSyncProducer([]string{"localhost:9092"}, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+
+	k.producer = producer
+	return producer, nil
+}
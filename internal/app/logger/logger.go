@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"fmt"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/redact"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Уровень общий для всех логгеров, меняется без пересоздания обработчика
+var level = new(slog.LevelVar)
+
+// Setup настраивает логгер по умолчанию, через него пишет и стандартный пакет log.
+// Секреты маскируются до записи в stdout и файл
+func Setup(conf configs.LogConfig) error {
+	if err := SetLevel(conf.Level); err != nil {
+		return err
+	}
+
+	var writers []io.Writer
+	if conf.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	if conf.File != "" {
+		writers = append(writers, &lumberjack.Logger{
+			Filename:   conf.File,       // Путь к файлу логов
+			MaxSize:    conf.MaxSize,    // Максимальный размер файла в мегабайтах
+			MaxBackups: conf.MaxBackups, // Максимальное количество старых файлов для хранения
+			MaxAge:     conf.MaxAge,     // Максимальное количество дней для хранения старых файлов
+			Compress:   conf.Compress,   // Сжимать ли старые файлы
+		})
+	}
+	if len(writers) == 0 {
+		writers = append(writers, io.Discard)
+	}
+	output := redact.Writer(io.MultiWriter(writers...))
+
+	options := &slog.HandlerOptions{AddSource: true, Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(conf.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(output, options)
+	case "text", "":
+		handler = slog.NewTextHandler(output, options)
+	default:
+		return fmt.Errorf("unknown log format: %s", conf.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel меняет уровень логирования, используется при перечитывании конфигурации
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level: %s", name)
+	}
+	level.Set(l)
+	return nil
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"ibTgBot/configs"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	tele "gopkg.in/telebot.v4"
+)
+
+const namespace = "ibtgbot"
+
+var (
+	KafkaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_consumed_total",
+		Help:      "Kafka messages consumed per topic.",
+	}, []string{"topic"})
+
+	KafkaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages between the high water mark and the last consumed offset.",
+	}, []string{"topic"})
+
+	KafkaDLQ = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_dead_letters_total",
+		Help:      "Kafka messages moved to the dead letter topic per source topic.",
+	}, []string{"topic"})
+
+	ErrorReports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "error_reports_total",
+		Help:      "Errors reported to the admin chat per source, before deduplication.",
+	}, []string{"source"})
+
+	TelegramSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_sends_total",
+		Help:      "Telegram send attempts by chat type, outcome and error class.",
+	}, []string{"chat_type", "outcome", "error_class"})
+
+	Telegram429 = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_rate_limited_total",
+		Help:      "Telegram 429 Too Many Requests responses.",
+	})
+
+	SendLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_send_duration_seconds",
+		Help:      "Telegram send latency by chat type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chat_type"})
+
+	FanOut = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "subscriber_fanout_size",
+		Help:      "Number of subscribers a post is sent to.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	DBLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_call_duration_seconds",
+		Help:      "Database call latency per operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Bot commands received.",
+	}, []string{"command"})
+
+	CommandUsers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "command_active_users",
+		Help:      "Distinct users that used a command in the last 24 hours.",
+	}, []string{"command"})
+)
+
+// Пользователь учитывается в CommandUsers, пока вызывал команду за последние usersWindow.
+// Устаревшие записи удаляются не чаще раза в usersPrune, чтобы множества не росли без ограничения
+const (
+	usersWindow = 24 * time.Hour
+	usersPrune  = time.Minute
+)
+
+// Последний вызов команды пользователями для CommandUsers
+var (
+	usersMu     sync.Mutex
+	users       = make(map[string]map[int64]time.Time)
+	usersPruned time.Time
+)
+
+// ObserveCommand учитывает вызов команды и пользователя, который ее вызвал
+func ObserveCommand(command string, userId int64) {
+	Commands.WithLabelValues(command).Inc()
+
+	now := time.Now()
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	if users[command] == nil {
+		users[command] = make(map[int64]time.Time)
+	}
+	users[command][userId] = now
+
+	if now.Sub(usersPruned) >= usersPrune {
+		usersPruned = now
+		for name, seen := range users {
+			for id, last := range seen {
+				if now.Sub(last) > usersWindow {
+					delete(seen, id)
+				}
+			}
+			CommandUsers.WithLabelValues(name).Set(float64(len(seen)))
+		}
+		return
+	}
+	CommandUsers.WithLabelValues(command).Set(float64(len(users[command])))
+}
+
+// ObserveDB учитывает длительность вызова БД, использовать через defer:
+//
+//	defer metrics.ObserveDB("GetSubscribers", time.Now(), &err)
+func ObserveDB(operation string, start time.Time, err *error) {
+	outcome := "ok"
+	if err != nil && *err != nil {
+		outcome = "error"
+	}
+	DBLatency.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSend учитывает отправку сообщения в Telegram
+func ObserveSend(chatId int64, start time.Time, err error) {
+	chatType := ChatType(chatId)
+	SendLatency.WithLabelValues(chatType).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		TelegramSends.WithLabelValues(chatType, "ok", "").Inc()
+		return
+	}
+
+	class := ErrorClass(err)
+	if class == "rate_limit" {
+		Telegram429.Inc()
+	}
+	TelegramSends.WithLabelValues(chatType, "error", class).Inc()
+}
+
+// ChatType различает каналы и группы (отрицательный ID) и личные чаты
+func ChatType(chatId int64) string {
+	if chatId < 0 {
+		return "channel"
+	}
+	return "user"
+}
+
+// ErrorClass сводит ошибку Telegram к небольшому набору классов для меток
+func ErrorClass(err error) string {
+	var flood tele.FloodError
+	var tgErr *tele.Error
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &flood):
+		return "rate_limit"
+	case errors.Is(err, tele.ErrBlockedByUser), errors.Is(err, tele.ErrUserIsDeactivated):
+		return "blocked"
+	case errors.Is(err, tele.ErrChatNotFound):
+		return "chat_not_found"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	case errors.As(err, &tgErr):
+		return "api_" + strconv.Itoa(tgErr.Code)
+	default:
+		return "other"
+	}
+}
+
+type Server struct {
+	srv *http.Server
+}
+
+func New(conf *configs.Conf) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &Server{
+		srv: &http.Server{Addr: conf.Metrics.Listen, Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+	}
+}
+
+// Run запускает HTTP сервер /metrics, пустой адрес отключает сервер
+func (s *Server) Run() error {
+	if s.srv.Addr == "" {
+		slog.Info("Metrics endpoint disabled")
+		return nil
+	}
+
+	slog.Info("Metrics endpoint started", "listen", s.srv.Addr)
+	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,73 @@
+package redact
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Заменитель секретов в логах
+const mask = "***"
+
+// Слишком короткие значения не маскируем, чтобы не портить логи
+const minLen = 4
+
+var (
+	mu       sync.RWMutex
+	secrets  []string
+	replacer = strings.NewReplacer()
+)
+
+// Add регистрирует секреты (токены, пароли), которые не должны попасть в логи
+func Add(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, value := range values {
+		// При перечитывании конфигурации те же секреты приходят повторно
+		if len(value) < minLen || slices.Contains(secrets, value) {
+			continue
+		}
+		secrets = append(secrets, value)
+	}
+
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// String маскирует все зарегистрированные секреты в строке
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return replacer.Replace(s)
+}
+
+// Value возвращает маску для непустого значения, используется в String() конфигурации
+func Value(s string) string {
+	if s == "" {
+		return ""
+	}
+	return mask
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer оборачивает вывод логов и маскирует в нем секреты,
+// в том числе в ошибках telebot и драйвера MySQL
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (r *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
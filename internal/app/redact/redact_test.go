@@ -0,0 +1,77 @@
+package redact
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const (
+	token    = "123456:AAE-secret-token"
+	password = "db-password"
+)
+
+func TestString(t *testing.T) {
+	Add(token, password, "abc")
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"telebot url", "Post https://api.telegram.org/bot" + token + "/sendMessage: timeout",
+			"Post https://api.telegram.org/bot***/sendMessage: timeout"},
+		{"dlq header", "x-error: dial tcp: user=bot password=" + password, "x-error: dial tcp: user=bot password=***"},
+		{"several", token + " " + password, "*** ***"},
+		{"short values are not secrets", "abc abcd", "abc abcd"},
+		{"no secrets", "plain text", "plain text"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := String(tc.in); got != tc.want {
+				t.Errorf("String(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"", ""},
+		{"x", mask},
+		{token, mask},
+	}
+	for _, tc := range cases {
+		if got := Value(tc.in); got != tc.want {
+			t.Errorf("Value(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestWriterFields(t *testing.T) {
+	Add(token, password)
+
+	cases := []struct {
+		name  string
+		attrs []any
+	}{
+		{"error field", []any{"error", "Post https://api.telegram.org/bot" + token + "/getMe"}},
+		{"header field", []any{"headers", map[string]string{"x-error": "login failed for " + password}}},
+		{"group", []any{slog.Group("db", "password", password)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(slog.NewJSONHandler(Writer(&buf), nil)).Info("test", tc.attrs...)
+
+			out := buf.String()
+			if strings.Contains(out, token) || strings.Contains(out, password) {
+				t.Errorf("secret in log output: %s", out)
+			}
+			if !strings.Contains(out, mask) {
+				t.Errorf("log output is not masked: %s", out)
+			}
+		})
+	}
+}
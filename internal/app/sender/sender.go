@@ -0,0 +1,68 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/metrics"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Количество попыток отправки при ответе 429
+const maxAttempts = 3
+
+type Service interface {
+	GetBot() *tele.Bot
+}
+
+// Sender отправляет сообщения с общим ограничением скорости,
+// чтобы массовые рассылки не упирались в лимиты Telegram
+type Sender struct {
+	s       Service
+	limiter *rate.Limiter
+}
+
+func New(conf *configs.Conf, s Service) *Sender {
+	return &Sender{
+		s:       s,
+		limiter: rate.NewLimiter(rate.Limit(conf.GetTG().RateLimit), 1),
+	}
+}
+
+// SetRate меняет лимит сообщений в секунду, вызывается при перечитывании конфигурации
+func (s *Sender) SetRate(perSecond int) {
+	s.limiter.SetLimit(rate.Limit(perSecond))
+}
+
+// Send ждет своей очереди по лимиту и отправляет сообщение,
+// при ответе 429 повторяет отправку после паузы из ответа Telegram
+func (s *Sender) Send(ctx context.Context, to tele.Recipient, what interface{}, opts ...interface{}) (*tele.Message, error) {
+	chatId, _ := strconv.ParseInt(to.Recipient(), 10, 64)
+
+	for attempt := 1; ; attempt++ {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		msg, err := s.s.GetBot().Send(to, what, opts...)
+		metrics.ObserveSend(chatId, start, err)
+
+		var flood tele.FloodError
+		if !errors.As(err, &flood) || attempt == maxAttempts {
+			return msg, err
+		}
+
+		slog.Warn("Telegram rate limit, retrying", "chat_id", chatId, "attempt", attempt, "retry_in", flood.RetryAfter)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(flood.RetryAfter) * time.Second):
+		}
+	}
+}
@@ -1,16 +1,25 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"ibTgBot/configs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	tele "gopkg.in/telebot.v4"
 )
 
 type Service struct {
-	botReady chan struct{}
-	b        *tele.Bot
-	tgConf   configs.TgConfig
+	botReady   chan struct{}
+	b          *tele.Bot
+	tgConf     configs.TgConfig
+	polling    atomic.Bool  // Поллер или вебхук принимает обновления
+	lastUpdate atomic.Int64 // Время последнего обновления, unix
 }
 
 func New(conf *configs.Conf) *Service {
@@ -39,25 +48,208 @@ func (s *Service) GetTG() configs.TgConfig {
 	return s.tgConf
 }
 
-func (s *Service) Run() error {
+// webhook собирает настройки вебхука из конфигурации, nil в режиме polling
+func (s *Service) webhook() *tele.Webhook {
+	if !s.tgConf.IsWebhook() {
+		return nil
+	}
+
+	webhook := &tele.Webhook{
+		Listen:      s.tgConf.WebhookListen,
+		SecretToken: s.tgConf.WebhookSecret,
+		Endpoint:    &tele.WebhookEndpoint{PublicURL: s.tgConf.WebhookURL},
+		// setWebhook вызывается в Init, чтобы ошибка не терялась внутри поллера
+		IgnoreSetWebhook: true,
+	}
+	if s.tgConf.WebhookCert != "" {
+		webhook.TLS = &tele.WebhookTLS{Key: s.tgConf.WebhookKey, Cert: s.tgConf.WebhookCert}
+		// Самоподписанный сертификат передаем Telegram при setWebhook
+		webhook.Endpoint.Cert = s.tgConf.WebhookCert
+	}
+	return webhook
+}
+
+// trackingPoller передает обновления вложенного поллера боту и отмечает время их получения.
+// Вложенный поллер получает собственный канал остановки: вебхук telebot сам закрывает
+// канал после сигнала, поэтому сигнал отправляется значением, а канал закрывает только
+// вебхук и только один раз. Канал остановки бота закрывает сам telebot
+type trackingPoller struct {
+	poller tele.Poller
+	track  func(*tele.Update) bool
+}
+
+func (p *trackingPoller) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	updates := make(chan tele.Update, 1)
+	pollerStop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		p.poller.Poll(b, updates, pollerStop)
+		close(done)
+	}()
+
+	for {
+		select {
+		case upd := <-updates:
+			if !p.track(&upd) {
+				continue
+			}
+			select {
+			case dest <- upd:
+			case <-stop:
+				stopPoller(pollerStop, updates, done)
+				return
+			}
+		case <-stop:
+			stopPoller(pollerStop, updates, done)
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// stopPoller отправляет сигнал остановки вложенному поллеру и ждет его завершения.
+// Обновления, пришедшие во время остановки, отбрасываются, чтобы обработчик вебхука
+// не блокировал остановку HTTP сервера
+func stopPoller(pollerStop chan struct{}, updates chan tele.Update, done chan struct{}) {
+	for {
+		select {
+		case pollerStop <- struct{}{}:
+			pollerStop = nil
+		case <-updates:
+		case <-done:
+			return
+		}
+	}
+}
+
+// client создает HTTP клиент с прокси и таймаутами из конфигурации
+func (s *Service) client() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   time.Duration(s.tgConf.DialTimeout) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = time.Duration(s.tgConf.DialTimeout) * time.Second
+
+	if s.tgConf.Proxy != "" {
+		// net/http поддерживает схемы http, https и socks5
+		proxyURL, err := url.Parse(s.tgConf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(s.tgConf.Timeout) * time.Second,
+	}, nil
+}
+
+// Init создает бота. Обработчики привязываются после Init и до Run,
+// чтобы первые обновления не пришли раньше, чем бот готов их обработать
+func (s *Service) Init() error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	webhook := s.webhook()
+	var poller tele.Poller = &tele.LongPoller{Timeout: 10 * time.Second}
+	if webhook != nil {
+		poller = webhook
+	}
+
 	b, err := tele.NewBot(tele.Settings{
+		URL:    s.tgConf.ApiURL,
 		Token:  s.tgConf.Token,
-		Poller: &tele.LongPoller{Timeout: 10 * time.Second},
+		Poller: &trackingPoller{poller: poller, track: s.trackUpdate},
+		Client: client,
 	})
 
 	if err != nil {
 		return err
 	}
+
+	if webhook != nil {
+		if err := b.SetWebhook(webhook); err != nil {
+			return fmt.Errorf("failed to set webhook: %w", err)
+		}
+	} else if err := b.RemoveWebhook(); err != nil {
+		// Пока вебхук, оставшийся от режима webhook, не снят, getUpdates возвращает 409
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
 	s.b = b
 
 	// Закрытие канала уведомления о готовности бота
 	close(s.botReady)
+	return nil
+}
 
+// Run запускает получение обновлений и блокируется до вызова Stop. Если Init
+// не вызывался, бот создается здесь
+func (s *Service) Run() error {
+	if s.b == nil {
+		if err := s.Init(); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Bot started", "mode", s.tgConf.Mode, "bot", s.b.Me.Username)
+	s.polling.Store(true)
 	s.b.Start()
+	s.polling.Store(false)
 
 	return nil
 }
 
+// trackUpdate отмечает время получения обновления и пропускает его дальше
+func (s *Service) trackUpdate(_ *tele.Update) bool {
+	s.lastUpdate.Store(time.Now().Unix())
+	return true
+}
+
+// Ready проверяет, что бот инициализирован и получает обновления
+func (s *Service) Ready() error {
+	select {
+	case <-s.botReady:
+	default:
+		return errors.New("bot is not initialized")
+	}
+
+	if !s.polling.Load() {
+		return fmt.Errorf("%s poller is not running", s.tgConf.Mode)
+	}
+	return nil
+}
+
+// LastUpdate возвращает время последнего полученного обновления
+func (s *Service) LastUpdate() time.Time {
+	if last := s.lastUpdate.Load(); last > 0 {
+		return time.Unix(last, 0)
+	}
+	return time.Time{}
+}
+
+// Stop останавливает получение обновлений. Вебхук снимается, только если включен
+// tg.webhookRemove: остальные реплики за балансировщиком продолжают принимать обновления
+func (s *Service) Stop() {
+	if s.b == nil {
+		return
+	}
+	s.b.Stop()
+
+	if s.tgConf.IsWebhook() && s.tgConf.WebhookRemove {
+		if err := s.b.RemoveWebhook(); err != nil {
+			slog.Error("Failed to delete webhook", "error", err)
+			return
+		}
+		slog.Info("Webhook deleted")
+	}
+}
+
 func (s *Service) GetBotReady() chan struct{} {
 	return s.botReady
 }
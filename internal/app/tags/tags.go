@@ -0,0 +1,206 @@
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"ibTgBot/internal/app/db"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Интервал планового обновления каталога
+const refreshInterval = 15 * time.Minute
+
+// Лимиты тегов, загружаемых из БД для одного языка. Выборка mainTag=false содержит
+// и подтеги, поэтому ее лимит такой же, как у списка тегов администратора
+const (
+	mainLimit = 99
+	allLimit  = 999
+)
+
+type DB interface {
+	ReadTags(limit int, mainTag bool, lang string) ([]db.Tag, error)
+}
+
+// Publisher рассылает событие изменения тегов остальным репликам бота
+type Publisher interface {
+	PublishTagsChanged(lang string) error
+}
+
+// Catalog хранит теги в памяти для каждого языка, чтобы отрисовка
+// клавиатур не обращалась к БД
+type Catalog struct {
+	mu     sync.RWMutex
+	d      DB
+	p      Publisher
+	langs  []string
+	list   map[string][]db.Tag
+	byID   map[string]map[int]db.Tag
+	main   map[string][]db.Tag         // Основные теги и теги без группы
+	groups map[string]map[int][]db.Tag // Подтеги по ID основного тега
+}
+
+type GetTagsIn interface {
+	Tags(lang string) []db.Tag
+}
+
+type RefreshIn interface {
+	Refresh(lang string) error
+}
+
+func New(d DB, langs ...string) *Catalog {
+	return &Catalog{
+		d:      d,
+		langs:  langs,
+		list:   make(map[string][]db.Tag),
+		byID:   make(map[string]map[int]db.Tag),
+		main:   make(map[string][]db.Tag),
+		groups: make(map[string]map[int][]db.Tag),
+	}
+}
+
+// SetPublisher подключает публикацию событий изменения тегов. Издатель создается
+// после каталога, потому что сам перечитывает каталог по событию
+func (c *Catalog) SetPublisher(p Publisher) {
+	c.p = p
+}
+
+// Changed вызывается после изменения тегов в БД: перечитывает каталог этой реплики,
+// чтобы изменения сразу попали в меню, и публикует событие для остальных реплик
+func (c *Catalog) Changed(lang string) error {
+	var errs []error
+	if err := c.Refresh(lang); err != nil {
+		errs = append(errs, err)
+	}
+	if c.p != nil {
+		if err := c.p.PublishTagsChanged(lang); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		slog.Error("Failed to propagate tags change", "lang", lang, "error", err)
+	}
+	return err
+}
+
+// Load загружает теги всех языков, вызывается при старте. Ошибка одного языка
+// не мешает загрузить остальные, ошибки всех языков возвращаются вместе
+func (c *Catalog) Load() error {
+	var errs []error
+	for _, lang := range c.langs {
+		if err := c.Refresh(lang); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run периодически перечитывает каталог из БД
+func (c *Catalog) Run() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, lang := range c.langs {
+			if err := c.Refresh(lang); err != nil {
+				slog.Error("Failed to refresh tags catalog", "lang", lang, "error", err)
+			}
+		}
+	}
+}
+
+// Refresh перечитывает теги указанного языка, пустой lang обновляет все языки
+func (c *Catalog) Refresh(lang string) error {
+	if lang == "" {
+		return c.Load()
+	}
+
+	all, err := c.d.ReadTags(allLimit, false, lang)
+	if err != nil {
+		return fmt.Errorf("failed to read tags for %s: %w", lang, err)
+	}
+	mainTags, err := c.d.ReadTags(mainLimit, true, lang)
+	if err != nil {
+		return fmt.Errorf("failed to read main tags for %s: %w", lang, err)
+	}
+	if len(all) >= allLimit || len(mainTags) >= mainLimit {
+		slog.Warn("Tags catalog may be truncated by the limit", "lang", lang,
+			"tags", len(all), "main", len(mainTags), "limit", allLimit, "main_limit", mainLimit)
+	}
+
+	// В меню пользователей только активные теги
+	tags := make([]db.Tag, 0, len(all))
+	for _, tag := range all {
+		if tag.Active {
+			tags = append(tags, tag)
+		}
+	}
+	isMain := make(map[int]bool, len(mainTags))
+	for _, tag := range mainTags {
+		if tag.Active {
+			isMain[tag.ID] = true
+		}
+	}
+
+	byID := make(map[int]db.Tag, len(tags))
+	for _, tag := range tags {
+		byID[tag.ID] = tag
+	}
+
+	// Основные теги определяет флаг mainTag, остальные группируются по parent.
+	// Подтег, основной тег которого не загружен или отключен, показывается отдельно
+	var main []db.Tag
+	groups := make(map[int][]db.Tag)
+	for _, tag := range tags {
+		if !isMain[tag.ID] && isMain[tag.Parent] {
+			groups[tag.Parent] = append(groups[tag.Parent], tag)
+			continue
+		}
+		main = append(main, tag)
+	}
+
+	c.mu.Lock()
+	c.list[lang] = tags
+	c.byID[lang] = byID
+	c.main[lang] = main
+	c.groups[lang] = groups
+	c.mu.Unlock()
+
+	slog.Info("Tags catalog refreshed", "lang", lang, "count", len(tags))
+	return nil
+}
+
+// Tags возвращает теги языка в порядке, полученном из БД
+func (c *Catalog) Tags(lang string) []db.Tag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.list[lang]
+}
+
+func (c *Catalog) ByID(lang string, id int) (db.Tag, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tag, ok := c.byID[lang][id]
+	return tag, ok
+}
+
+// Main возвращает основные теги языка, подтеги доступны через Children
+func (c *Catalog) Main(lang string) []db.Tag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.main[lang]
+}
+
+// Children возвращает подтеги основного тега
+func (c *Catalog) Children(lang string, parent int) []db.Tag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.groups[lang][parent]
+}
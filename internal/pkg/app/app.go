@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ibTgBot/configs"
+	"ibTgBot/internal/app/alerts"
+	"ibTgBot/internal/app/api"
+	"ibTgBot/internal/app/db"
+	"ibTgBot/internal/app/handlers"
+	"ibTgBot/internal/app/health"
+	"ibTgBot/internal/app/i18n"
+	"ibTgBot/internal/app/kafka"
+	"ibTgBot/internal/app/logger"
+	"ibTgBot/internal/app/metrics"
+	"ibTgBot/internal/app/sender"
+	"ibTgBot/internal/app/service"
+	"ibTgBot/internal/app/tags"
+	"ibTgBot/internal/app/tracing"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Сколько ждать остановки HTTP серверов и отправки трасс
+const shutdownTimeout = 10 * time.Second
+
+// App собирает компоненты бота, запускает их и останавливает по сигналу
+type App struct {
+	conf    *configs.Conf
+	s       *service.Service
+	d       *db.DB
+	t       *tags.Catalog
+	snd     *sender.Sender
+	a       *alerts.Alerts
+	h       *handlers.Handlers
+	k       *kafka.Kafka
+	metrics *metrics.Server
+	health  *health.Health
+	api     *api.API
+	flags   *configs.Flags
+}
+
+func New(conf *configs.Conf) *App {
+	app := &App{conf: conf, flags: configs.NewFlags(conf.Features)}
+
+	app.s = service.New(conf)
+	app.d = db.New(conf)
+	app.t = tags.New(app.d, i18n.Langs()...)
+	app.snd = sender.New(conf, app.s)
+	app.a = alerts.New(conf, app.snd)
+	app.d.SetAlerts(app.a)
+	app.k = kafka.New(app.s, app.d, app.t, app.a, app.flags)
+	app.t.SetPublisher(app.k)
+	app.health = health.New(conf, app.s, app.d, app.k)
+	app.h = handlers.New(conf, app.s, app.d, app.t, app.health, app.snd, app.a, app.flags)
+	app.metrics = metrics.New(conf)
+	app.api = api.New(conf, app.d, app.t, app.snd)
+
+	return app
+}
+
+// Run запускает бота и блокируется до SIGINT/SIGTERM или ошибки одного из серверов
+func (app *App) Run() error {
+	if err := logger.Setup(app.conf.Log); err != nil {
+		return fmt.Errorf("failed to setup logger: %w", err)
+	}
+	slog.Info("Конфигурация загружена", "config", app.conf.String())
+
+	if err := i18n.SetOverrides(app.conf.Messages); err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(app.conf.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to setup tracing: %w", err)
+	}
+
+	// Без каталога меню категорий пусто, но бот работает, каталог перечитается по расписанию
+	if err := app.t.Load(); err != nil {
+		slog.Error("Failed to load tags catalog", "error", err)
+	}
+
+	if err := app.s.Init(); err != nil {
+		return fmt.Errorf("failed to create bot: %w", err)
+	}
+	app.h.SetupHandlers()
+
+	errs := make(chan error, 4)
+	serve := func(name string, run func() error) {
+		go func() {
+			if err := run(); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}()
+	}
+	serve("bot", app.h.Run)
+	serve("metrics", app.metrics.Run)
+	serve("health", app.health.Run)
+	serve("api", app.api.Run)
+
+	go app.a.Run()
+	go app.t.Run()
+	app.k.Run()
+	app.conf.Watch(app.apply, app.h.NotifyReload)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case sig := <-stop:
+		slog.Info("Получен сигнал остановки", "signal", sig.String())
+	case err = <-errs:
+		slog.Error("Компонент остановился с ошибкой", "error", err)
+	}
+
+	app.stop(shutdownTracing)
+	return err
+}
+
+// apply применяет перечитанную конфигурацию. Watch передает сюда только изменения
+// параметров, которые меняются без перезапуска, применяются только измененные.
+// Параметры, которые могут не примениться, идут первыми: при ошибке остальные не меняются
+func (app *App) apply(next *configs.Conf, changes []string) error {
+	if configs.Changed(changes, "messages") {
+		if err := i18n.SetOverrides(next.Messages); err != nil {
+			return err
+		}
+	}
+	if configs.Changed(changes, "log.level") {
+		if err := logger.SetLevel(next.Log.Level); err != nil {
+			return fmt.Errorf("failed to set log level: %w", err)
+		}
+	}
+
+	tg := next.GetTG()
+	if configs.Changed(changes, "tg.admins") {
+		app.h.SetAdmins(tg.Admins)
+	}
+	if configs.Changed(changes, "tg.rateLimit") {
+		app.snd.SetRate(tg.RateLimit)
+	}
+	if configs.Changed(changes, "tg.errorChat") {
+		app.a.SetChat(tg.ErrorChat)
+	}
+	if configs.Changed(changes, "tg.ruCanal") || configs.Changed(changes, "tg.esCanal") {
+		app.k.SetChannels(tg.RuCanal, tg.EsCanal)
+	}
+	if configs.Changed(changes, "features") {
+		app.flags.Set(next.Features)
+		// Отключенные команды убираются из меню, включенные возвращаются
+		app.h.RefreshCommands()
+	}
+	return nil
+}
+
+// stop останавливает прием обновлений, потребителей Kafka и HTTP серверы, ждет обработки
+// полученных постов, отправляет оставшиеся отчеты об ошибках и трассы, закрывает пул соединений с БД
+func (app *App) stop(shutdownTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	app.s.Stop()
+
+	var errs []error
+	errs = append(errs,
+		app.k.Stop(ctx),
+		app.api.Stop(ctx),
+		app.health.Stop(ctx),
+		app.metrics.Stop(ctx),
+	)
+	app.a.Stop()
+	errs = append(errs, shutdownTracing(ctx), app.d.Close())
+
+	if err := errors.Join(errs...); err != nil {
+		slog.Error("Ошибка при остановке", "error", err)
+	}
+	slog.Info("Бот остановлен")
+}